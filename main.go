@@ -4,7 +4,9 @@ import (
 	"context"
 	_ "embed"
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/blaubaer/talk-indicator/pkg/api"
 	"github.com/blaubaer/talk-indicator/pkg/app"
+	"github.com/blaubaer/talk-indicator/pkg/config"
 	log "github.com/echocat/slf4g"
 	"github.com/echocat/slf4g/native"
 	_ "github.com/echocat/slf4g/native"
@@ -27,8 +29,11 @@ func main() {
 	}
 
 	var a app.App
+	var c config.Config
+	var s api.Server
 
-	cmd := kingpin.New(os.Args[0], "").
+	cmd := newApplication(&a, &c, &s, &lv)
+	cmd.GetCommand("run").
 		Action(func(*kingpin.ParseContext) (rErr error) {
 			if err := a.Initialize(); err != nil {
 				return err
@@ -49,9 +54,29 @@ func main() {
 				cancel()
 			}()
 
+			if err := s.Start(ctx, &a); err != nil {
+				return err
+			}
+			go watchReloads(ctx, &a, &c, &lv, config.SnapshotOf(cmd))
+
 			return a.Run(ctx)
 		})
+
+	cmd.FatalIfError(c.Prepare(cmd, os.Args[1:]), "")
+	kingpin.MustParse(cmd.Parse(os.Args[1:]))
+}
+
+func newApplication(a *app.App, c *config.Config, s *api.Server, lv *value.Provider) *kingpin.Application {
+	cmd := kingpin.New(os.Args[0], "")
+	cmd.Command("run", "Watches the audio and video sessions and signals the state (default).").
+		Default()
 	a.SetupConfiguration(cmd)
+	c.SetupConfiguration(cmd)
+	s.SetupConfiguration(cmd)
+	(&api.OverrideCommand{Server: s}).SetupConfiguration(cmd)
+	(&app.DevicesCommand{App: a}).SetupConfiguration(cmd)
+	(&app.SignalTestCommand{App: a}).SetupConfiguration(cmd)
+	(&app.HueCommand{App: a}).SetupConfiguration(cmd)
 
 	cmd.Flag("log.level", "").
 		SetValue(lv.Level)
@@ -62,5 +87,61 @@ func main() {
 		Default("auto").
 		SetValue(lv.Consumer.Formatter.ColorMode)
 
-	kingpin.MustParse(cmd.Parse(os.Args[1:]))
+	return cmd
+}
+
+// watchReloads reloads the configuration every time SIGHUP is received or the
+// configuration file changes.
+func watchReloads(ctx context.Context, a *app.App, c *config.Config, lv *value.Provider, current config.Snapshot) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	changes := c.Watch(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info("SIGHUP received. Reloading configuration...")
+		case <-changes:
+			log.With("file", c.File).
+				Info("Configuration file changed. Reloading configuration...")
+		}
+
+		next, err := reload(ctx, a, lv, current)
+		if err != nil {
+			log.WithError(err).
+				Error("Cannot reload configuration; keeping the current one.")
+			continue
+		}
+		current = next
+	}
+}
+
+// reload parses the arguments and the configuration file again into a new
+// app.App and hands it over to the running one.
+func reload(ctx context.Context, a *app.App, lv *value.Provider, current config.Snapshot) (config.Snapshot, error) {
+	var candidate app.App
+	var c config.Config
+	// The HTTP API keeps running as it is; only its configuration is parsed.
+	var s api.Server
+
+	cmd := newApplication(&candidate, &c, &s, lv)
+	if err := c.Prepare(cmd, os.Args[1:]); err != nil {
+		return nil, err
+	}
+	if _, err := cmd.Parse(os.Args[1:]); err != nil {
+		return nil, err
+	}
+
+	next := config.SnapshotOf(cmd)
+	if err := a.Reload(ctx, &candidate, app.Changes{
+		Audio:  current.Differs(next, "audio."),
+		Video:  current.Differs(next, "video."),
+		Signal: current.Differs(next, "signal."),
+	}); err != nil {
+		return nil, err
+	}
+	return next, nil
 }
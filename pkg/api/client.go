@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/app"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Client calls the HTTP API of a running instance.
+type Client struct {
+	// Address of the running instance, like localhost:8080. Addresses
+	// without host or with an unspecified one (like :8080 or 0.0.0.0:8080)
+	// are called via localhost.
+	Address string
+	Timeout time.Duration
+}
+
+func (this *Client) SetOverride(ctx context.Context, req OverrideRequest) (*app.Override, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode override request: %w", err)
+	}
+	var result *app.Override
+	if err := this.call(ctx, http.MethodPost, "/override", body, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *Client) call(ctx context.Context, method, path string, body []byte, target any) error {
+	base, err := this.baseUrl()
+	if err != nil {
+		return err
+	}
+	if v := this.Timeout; v > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, base+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request %s %s: %w", method, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot call %s %s: %w", method, req.URL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response of %s %s: %w", method, req.URL, err)
+	}
+	if resp.StatusCode >= 300 {
+		var e ErrorResponse
+		if json.Unmarshal(b, &e) == nil && e.Error != "" {
+			return fmt.Errorf("%s %s failed with %d: %s", method, req.URL, resp.StatusCode, e.Error)
+		}
+		return fmt.Errorf("%s %s failed with %d", method, req.URL, resp.StatusCode)
+	}
+	if target != nil && len(b) > 0 {
+		if err := json.Unmarshal(b, target); err != nil {
+			return fmt.Errorf("cannot decode response of %s %s: %w", method, req.URL, err)
+		}
+	}
+	return nil
+}
+
+func (this *Client) baseUrl() (string, error) {
+	if this.Address == "" {
+		return "", fmt.Errorf("no address of the running instance configured; set http.listen")
+	}
+	host, port, err := net.SplitHostPort(this.Address)
+	if err != nil {
+		return "", fmt.Errorf("illegal-address: %s", this.Address)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/alecthomas/kingpin/v2"
+	"os"
+	"time"
+)
+
+// OverrideCommand sets or clears the override of a running instance, which
+// is reached via the address of Server.
+type OverrideCommand struct {
+	Server *Server
+
+	State    string
+	Duration time.Duration
+	Timeout  time.Duration
+}
+
+func (this *OverrideCommand) SetupConfiguration(app *kingpin.Application) {
+	cmd := app.Command("override", "Pins the state signaled by the running instance (reached via http.listen), or returns to the detected one using auto.").
+		Action(func(*kingpin.ParseContext) error {
+			return this.run(context.Background())
+		})
+	cmd.Arg("state", "on, off, muted, speaking, camera or auto.").
+		Required().
+		StringVar(&this.State)
+	cmd.Flag("duration", "How long the override lasts. If 0 it lasts until it is cleared.").
+		Short('d').
+		Default("0s").
+		DurationVar(&this.Duration)
+	cmd.Flag("timeout", "How long to wait for the running instance.").
+		Default("10s").
+		DurationVar(&this.Timeout)
+}
+
+func (this *OverrideCommand) run(ctx context.Context) error {
+	client := Client{
+		Address: this.Server.Listen,
+		Timeout: this.Timeout,
+	}
+	req := OverrideRequest{State: this.State}
+	if v := this.Duration; v > 0 {
+		req.Duration = v.String()
+	}
+
+	override, err := client.SetOverride(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case override == nil:
+		_, err = fmt.Fprintln(os.Stdout, "Override cleared.")
+	case override.Until == nil:
+		_, err = fmt.Fprintf(os.Stdout, "Override set to %v until it is cleared.\n", override.State)
+	default:
+		_, err = fmt.Fprintf(os.Stdout, "Override set to %v until %v.\n", override.State, override.Until.Local().Format(time.DateTime))
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/app"
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"github.com/blaubaer/talk-indicator/pkg/metrics"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	log "github.com/echocat/slf4g"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Server provides the status of a running app.App via HTTP.
+type Server struct {
+	// Listen is the address to listen to, like localhost:8080. If empty no
+	// server is started.
+	Listen string
+}
+
+type StateResponse struct {
+	State    signal.State  `json:"state"`
+	Detected signal.State  `json:"detected"`
+	Since    *time.Time    `json:"since,omitempty"`
+	Checked  *time.Time    `json:"checked,omitempty"`
+	Override *app.Override `json:"override,omitempty"`
+}
+
+// OverrideRequest is the body of POST /override. State can be any
+// signal.State or auto (which clears the override). If Duration is empty the
+// override lasts until it is cleared.
+type OverrideRequest struct {
+	State    string `json:"state"`
+	Duration string `json:"duration,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type DevicesResponse struct {
+	Audio audio.Devices `json:"audio"`
+	Video audio.Devices `json:"video"`
+}
+
+func (this *Server) SetupConfiguration(using common.FlagHolder) {
+	using.Flag("http.listen", "Address (like localhost:8080) to serve the HTTP API at, which provides GET /state, /devices, /signals, /metrics and /override as well as POST and DELETE /override. If empty the API is disabled. The override command uses it to reach the running instance.").
+		Envar("TI_HTTP_LISTEN").
+		StringVar(&this.Listen)
+}
+
+// Start starts serving the HTTP API for the given app.App in the background
+// until ctx is done. It fails if it is not possible to listen to Listen.
+func (this *Server) Start(ctx context.Context, target *app.App) error {
+	if this.Listen == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", this.Listen)
+	if err != nil {
+		return fmt.Errorf("cannot listen to %s: %w", this.Listen, err)
+	}
+
+	server := &http.Server{
+		Handler:           this.handler(target),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		sCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(sCtx); err != nil {
+			log.WithError(err).
+				Warn("Cannot shutdown HTTP API.")
+		}
+	}()
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.WithError(err).
+				Error("HTTP API stopped unexpectedly.")
+		}
+	}()
+
+	log.With("address", ln.Addr()).
+		Info("HTTP API started.")
+	return nil
+}
+
+func (this *Server) handler(target *app.App) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /state", func(w http.ResponseWriter, r *http.Request) {
+		status := target.Status()
+		respond(w, http.StatusOK, StateResponse{
+			State:    status.State,
+			Detected: status.Detected,
+			Since:    status.Since,
+			Checked:  status.Checked,
+			Override: status.Override,
+		})
+	})
+	mux.HandleFunc("GET /devices", func(w http.ResponseWriter, r *http.Request) {
+		status := target.Status()
+		result := DevicesResponse{
+			Audio: status.AudioDevices,
+			Video: status.VideoDevices,
+		}
+		if result.Audio == nil {
+			result.Audio = audio.Devices{}
+		}
+		if result.Video == nil {
+			result.Video = audio.Devices{}
+		}
+		respond(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /signals", func(w http.ResponseWriter, r *http.Request) {
+		result := target.Status().Signals
+		if result == nil {
+			result = []signal.Health{}
+		}
+		respond(w, http.StatusOK, result)
+	})
+	mux.Handle("GET /metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /override", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, target.Status().Override)
+	})
+	mux.HandleFunc("POST /override", func(w http.ResponseWriter, r *http.Request) {
+		var req OverrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respond(w, http.StatusBadRequest, ErrorResponse{fmt.Sprintf("illegal-override-request: %v", err)})
+			return
+		}
+		override, err := req.toOverride()
+		if err != nil {
+			respond(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+			return
+		}
+		if err := target.SetOverride(r.Context(), override); err != nil {
+			respond(w, http.StatusServiceUnavailable, ErrorResponse{err.Error()})
+			return
+		}
+		respond(w, http.StatusOK, override)
+	})
+	mux.HandleFunc("DELETE /override", func(w http.ResponseWriter, r *http.Request) {
+		if err := target.SetOverride(r.Context(), nil); err != nil {
+			respond(w, http.StatusServiceUnavailable, ErrorResponse{err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func (this OverrideRequest) toOverride() (*app.Override, error) {
+	if strings.EqualFold(strings.TrimSpace(this.State), "auto") {
+		return nil, nil
+	}
+	var state signal.State
+	if err := state.Set(this.State); err != nil {
+		return nil, err
+	}
+	var duration time.Duration
+	if v := this.Duration; v != "" {
+		var err error
+		if duration, err = time.ParseDuration(v); err != nil || duration < 0 {
+			return nil, fmt.Errorf("illegal-override-duration: %s", v)
+		}
+	}
+	return app.NewOverride(state, duration), nil
+}
+
+func respond(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(body); err != nil {
+		log.WithError(err).
+			Debug("Cannot write HTTP API response.")
+	}
+}
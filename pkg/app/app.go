@@ -2,9 +2,12 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"github.com/blaubaer/talk-indicator/pkg/audio"
 	"github.com/blaubaer/talk-indicator/pkg/common"
+	"github.com/blaubaer/talk-indicator/pkg/rule"
 	"github.com/blaubaer/talk-indicator/pkg/signal"
+	"github.com/blaubaer/talk-indicator/pkg/video"
 	log "github.com/echocat/slf4g"
 	"regexp"
 	"sync"
@@ -12,8 +15,9 @@ import (
 )
 
 type App struct {
-	AudioStack audio.Stack
-	Signal     signal.Facade
+	AudioStack *audio.Stack
+	VideoStack *video.Stack
+	Signal     *signal.Facade
 
 	CheckInterval   time.Duration
 	RefreshInterval time.Duration
@@ -21,12 +25,35 @@ type App struct {
 	IncludedSessionIdentifiers *regexp.Regexp
 	ExcludedSessionIdentifiers *regexp.Regexp
 
+	IncludedSessions audio.SessionFilters
+	ExcludedSessions audio.SessionFilters
+
+	SpeakingThreshold float32
+
+	OnDelay   time.Duration
+	OffGrace  time.Duration
+	MinOnTime time.Duration
+
+	RulesFile string
+
 	initialized sync.Once
+	debounce    debounce
+	rules       rule.Rules
+	reloads     chan reload
+	overrides   chan *Override
+	override    *Override
+	status      Status
+	statusMutex sync.RWMutex
 }
 
 func (this *App) ensure() {
 	this.initialized.Do(func() {
-		this.CheckInterval = 5 * time.Second
+		this.AudioStack = &audio.Stack{}
+		this.VideoStack = &video.Stack{}
+		this.Signal = &signal.Facade{}
+		this.reloads = make(chan reload)
+		this.overrides = make(chan *Override)
+		this.CheckInterval = 1 * time.Minute
 		this.RefreshInterval = 5 * time.Minute
 		this.ExcludedSessionIdentifiers = regexp.MustCompile(`\{[0-9a-f.]+}\.{[0-9a-f-]+}\|\\Device\\.+\\Windows\\System32\\svchost\.exe%.*`)
 	})
@@ -36,6 +63,7 @@ func (this *App) SetupConfiguration(using common.FlagHolder) {
 	this.ensure()
 
 	this.AudioStack.SetupConfiguration(using)
+	this.VideoStack.SetupConfiguration(using)
 	this.Signal.SetupConfiguration(using)
 
 	var includedSessionIdsDef, excludedSessionIdsDef string
@@ -46,7 +74,7 @@ func (this *App) SetupConfiguration(using common.FlagHolder) {
 		excludedSessionIdsDef = v.String()
 	}
 
-	using.Flag("checkInterval", "How often the state of the talk is checked.").
+	using.Flag("checkInterval", "How often the state of the talk is checked again, even if the audio type did not report any change.").
 		Envar("TI_CHECK_INTERVAL").
 		Default(this.CheckInterval.String()).
 		DurationVar(&this.CheckInterval)
@@ -62,6 +90,31 @@ func (this *App) SetupConfiguration(using common.FlagHolder) {
 		Envar("TI_EXCLUDED_SESSION_IDENTIFIERS").
 		Default(excludedSessionIdsDef).
 		RegexpVar(&this.ExcludedSessionIdentifiers)
+	using.Flag("includedSessions", "Which sessions should be respected for evaluation. Format: <field>=<value>[,<value>...]. Possible fields: process, path, cmdline, user, identifier. Values are case-insensitive and can contain * as wildcard. Example: process=zoom,teams").
+		Envar("TI_INCLUDED_SESSIONS").
+		SetValue(&this.IncludedSessions)
+	using.Flag("excludedSessions", "Which sessions should not be respected for evaluation. Same format as includedSessions.").
+		Envar("TI_EXCLUDED_SESSIONS").
+		SetValue(&this.ExcludedSessions)
+	using.Flag("speakingThreshold", "Peak level (between 0 and 1) of a session from which on the state speaking instead of on is signaled. 0 disables the detection of speaking.").
+		Envar("TI_SPEAKING_THRESHOLD").
+		Default("0").
+		Float32Var(&this.SpeakingThreshold)
+	using.Flag("onDelay", "How long a session has to be present before the signal is switched on.").
+		Envar("TI_ON_DELAY").
+		Default(this.OnDelay.String()).
+		DurationVar(&this.OnDelay)
+	using.Flag("offGrace", "How long no session has to be present before the signal is switched off.").
+		Envar("TI_OFF_GRACE").
+		Default(this.OffGrace.String()).
+		DurationVar(&this.OffGrace)
+	using.Flag("minOnTime", "Minimum time the signal stays on once it was switched on.").
+		Envar("TI_MIN_ON_TIME").
+		Default(this.MinOnTime.String()).
+		DurationVar(&this.MinOnTime)
+	using.Flag("rules", "YAML or JSON file with rules (list of name, when and state) which decide the state instead of the built-in evaluation. The first rule whose when expression matches any relevant session wins; if none matches the state is off.").
+		Envar("TI_RULES").
+		StringVar(&this.RulesFile)
 }
 
 func (this *App) Run(ctx context.Context) error {
@@ -69,77 +122,120 @@ func (this *App) Run(ctx context.Context) error {
 
 	var lastState *signal.State
 
-	ctxInner, cancel := context.WithCancel(ctx)
-	defer cancel()
+	var audioChannel, videoChannel <-chan audio.Devices
+	watch := func() context.CancelFunc {
+		ctxWatch, cancelWatch := context.WithCancel(ctx)
+		audioChannel = this.AudioStack.Watch(ctxWatch)
+		videoChannel = this.VideoStack.Watch(ctxWatch)
+		return cancelWatch
+	}
+	cancelWatch := watch()
+	defer func() { cancelWatch() }()
 
-	go func() {
-		for {
-			log.With("interval", this.RefreshInterval).
-				Debug("Wait until the next refresh...")
-			select {
-			case <-ctxInner.Done():
-				log.Debug("Refresh loop interrupted.")
-				return
-			case <-time.After(this.RefreshInterval):
+	var audioDevices, videoDevices audio.Devices
+	var recheck, overrideExpiry <-chan time.Time
+	refresh := time.After(this.RefreshInterval)
+	// The check is a safety resync which has to happen regardless of how
+	// many other events arrive in the meantime.
+	check := time.NewTimer(this.CheckInterval)
+	defer check.Stop()
+	for {
+		log.With("interval", this.CheckInterval).
+			Debug("Wait until the next change or check...")
+		select {
+		case <-ctx.Done():
+			log.Debug("Check loop interrupted.")
+			return nil
+		case v, ok := <-audioChannel:
+			if !ok {
+				log.Debug("Check loop interrupted.")
+				return nil
 			}
-
+			audioDevices = v
+		case v, ok := <-videoChannel:
+			if !ok {
+				log.Debug("Check loop interrupted.")
+				return nil
+			}
+			videoDevices = v
+		case <-recheck:
+			log.Debug("Check delayed state change...")
+		case v := <-this.overrides:
+			if v == nil && this.override != nil {
+				log.With("state", this.override.State).
+					Info("Override cleared.")
+			}
+			overrideExpiry = this.applyOverride(v)
+		case <-overrideExpiry:
+			log.With("state", this.override.State).
+				Info("Override expired.")
+			overrideExpiry = this.applyOverride(nil)
+		case r := <-this.reloads:
+			rewatch := r.changes.Audio || r.changes.Video
+			if rewatch {
+				// Stacks which are replaced must not be watched anymore while
+				// they are disposed.
+				cancelWatch()
+			}
+			err := this.reload(r.candidate, r.changes, lastState)
+			this.updateStatus(func(*Status) {})
+			r.result <- err
+			if rewatch {
+				cancelWatch = watch()
+			}
+			if err != nil {
+				continue
+			}
+			refresh = time.After(this.RefreshInterval)
+			check.Reset(this.CheckInterval)
+		case <-refresh:
+			refresh = time.After(this.RefreshInterval)
 			if err := this.Signal.Update(); err != nil {
 				log.WithError(err).
 					Error("Cannot update signal.")
+				this.updateStatus(func(*Status) {})
 				continue
 			}
-
 			if lastState != nil {
-				if err := this.Signal.Ensure(*lastState); err != nil {
-					log.WithError(err).
-						Error("Cannot ensure signal state.")
-					continue
-				}
+				this.Signal.Ensure(*lastState)
 			}
-		}
-	}()
-
-	first := true
-	for {
-		if first {
-			first = false
-		} else {
-			log.With("interval", this.CheckInterval).
-				Debug("Wait until the next check...")
-			select {
-			case <-ctx.Done():
-				log.Debug("Check loop interrupted.")
-				return nil
-			case <-time.After(this.CheckInterval):
+			this.updateStatus(func(*Status) {})
+			continue
+		case <-check.C:
+			check.Reset(this.CheckInterval)
+			v, err := this.AudioStack.FindDevices()
+			if err != nil {
+				log.WithError(err).
+					Error("Cannot find audio devices.")
+				continue
 			}
+			audioDevices = v
+			v, err = this.VideoStack.FindDevices()
+			if err != nil {
+				log.WithError(err).
+					Error("Cannot find video devices.")
+				continue
+			}
+			videoDevices = v
 		}
 
-		devices, err := this.AudioStack.FindDevices()
-		if err != nil {
-			log.WithError(err).
-				Error("Cannot find audio devices.")
-			continue
+		detected := this.evaluate(audioDevices, videoDevices)
+		state, wait := this.debounce.apply(this, detected, time.Now())
+		recheck = nil
+		if wait > 0 {
+			recheck = time.After(wait)
 		}
-
-		state := signal.StateOff
-		if devices.HasRelevantSession(func(candidate *audio.Session) bool {
-			if v := this.IncludedSessionIdentifiers; v != nil && v.String() != "" {
-				if !v.MatchString(candidate.Identifier) {
-					return false
-				}
-			}
-			if v := this.ExcludedSessionIdentifiers; v != nil && v.String() != "" {
-				if v.MatchString(candidate.Identifier) {
-					return false
-				}
-			}
-			return true
-		}) {
-			state = signal.StateOn
+		// The override wins over whatever was detected, but the detection
+		// (including its delays) continues to run in the background.
+		if v := this.override; v != nil {
+			state = v.State
 		}
 
-		log.With("devices", devices).
+		log.With("devices", audioDevices).
+			With("videoDevices", videoDevices).
+			With("detected", detected).
 			With("state", state).
+			With("overridden", this.override != nil).
 			Debug("Devices and their sessions discovered.")
 
 		if lastState == nil || *lastState != state {
@@ -149,16 +245,122 @@ func (this *App) Run(ctx context.Context) error {
 			}
 			log.With("lastState", *lastState).
 				With("state", state).
+				With("overridden", this.override != nil).
 				Info("State change detected.")
 		}
 
-		if err := this.Signal.Ensure(state); err != nil {
+		// Signals which fail to ensure the state are retried by the refresh.
+		changed := *lastState != state
+		this.observe(*lastState, state, audioDevices, videoDevices)
+		lastState = &state
+
+		this.Signal.Ensure(state)
+		this.updateStatus(func(status *Status) {
+			now := time.Now()
+			if changed || status.Since == nil {
+				status.Since = &now
+			}
+			status.Checked = &now
+			status.State = state
+			status.Detected = detected
+			status.AudioDevices = audioDevices
+			status.VideoDevices = videoDevices
+		})
+	}
+}
+
+// evaluate determines the state from all relevant sessions of the given
+// devices. If rules are configured these decide. Otherwise a relevant camera
+// session wins over everything else; if at least one audio session is
+// speaking this wins over on, which wins over muted.
+func (this *App) evaluate(audioDevices, videoDevices audio.Devices) signal.State {
+	if len(this.rules) > 0 {
+		result, matched, err := this.rules.Evaluate(audioDevices, videoDevices, this.isRelevant, time.Now())
+		if err != nil {
 			log.WithError(err).
-				Error("It was not possible to ensure signal state.")
-			continue
+				Error("Cannot evaluate rules; assuming off.")
+			return signal.StateOff
 		}
+		if matched != nil {
+			log.With("rule", matched).
+				With("state", result).
+				Debug("Rule matched.")
+		}
+		return result
+	}
 
-		lastState = &state
+	if videoDevices.HasRelevantSession(this.isRelevant) {
+		return signal.StateCamera
+	}
+
+	result := signal.StateOff
+	for _, device := range audioDevices {
+		for _, session := range device.Sessions {
+			if !this.isRelevant(&session) {
+				continue
+			}
+			candidate := signal.StateOn
+			if device.Muted || session.Muted {
+				candidate = signal.StateMuted
+			} else if v := this.SpeakingThreshold; v > 0 && session.Peak >= v {
+				candidate = signal.StateSpeaking
+			}
+			if statePriority(candidate) > statePriority(result) {
+				result = candidate
+			}
+		}
+	}
+	return result
+}
+
+func (this *App) isRelevant(candidate *audio.Session) bool {
+	return this.judge(candidate).Relevant
+}
+
+// Verdict tells whether a session is respected for evaluation and why.
+type Verdict struct {
+	Relevant bool   `json:"relevant" yaml:"relevant"`
+	Reason   string `json:"reason" yaml:"reason"`
+}
+
+// judge applies all configured filters to the given session.
+func (this *App) judge(candidate *audio.Session) Verdict {
+	if v := this.IncludedSessionIdentifiers; v != nil && v.String() != "" {
+		if !v.MatchString(candidate.Identifier) {
+			return Verdict{false, "identifier not matched by includedSessionIdentifiers"}
+		}
+	}
+	if v := this.ExcludedSessionIdentifiers; v != nil && v.String() != "" {
+		if v.MatchString(candidate.Identifier) {
+			return Verdict{false, "identifier matched by excludedSessionIdentifiers"}
+		}
+	}
+	reason := "no filter applies"
+	if v := this.IncludedSessions; len(v) > 0 {
+		filter, ok := v.MatchingFilter(candidate)
+		if !ok {
+			return Verdict{false, "not matched by any includedSessions"}
+		}
+		reason = fmt.Sprintf("matched by includedSessions %v", filter)
+	}
+	if filter, ok := this.ExcludedSessions.MatchingFilter(candidate); ok {
+		return Verdict{false, fmt.Sprintf("matched by excludedSessions %v", filter)}
+	}
+	return Verdict{true, reason}
+}
+
+func statePriority(v signal.State) int {
+	switch v {
+	case signal.StateCamera:
+		return 4
+	case signal.StateSpeaking:
+		return 3
+	case signal.StateOn:
+		return 2
+	case signal.StateMuted:
+		return 1
+	default:
+		return 0
 	}
 }
 
@@ -174,9 +376,15 @@ func (this *App) Initialize() (rErr error) {
 		}
 	}()
 
+	if err := this.loadRules(); err != nil {
+		return err
+	}
 	if err := this.AudioStack.Initialize(); err != nil {
 		return err
 	}
+	if err := this.VideoStack.Initialize(); err != nil {
+		return err
+	}
 	if err := this.Signal.Initialize(); err != nil {
 		return err
 	}
@@ -185,6 +393,21 @@ func (this *App) Initialize() (rErr error) {
 	return nil
 }
 
+func (this *App) loadRules() error {
+	this.rules = nil
+	if v := this.RulesFile; v != "" {
+		rules, err := rule.Load(v)
+		if err != nil {
+			return err
+		}
+		log.With("file", v).
+			With("rules", len(rules)).
+			Info("Rules loaded.")
+		this.rules = rules
+	}
+	return nil
+}
+
 func (this *App) Dispose() (rErr error) {
 	this.ensure()
 
@@ -194,11 +417,19 @@ func (this *App) Dispose() (rErr error) {
 		}
 	}()
 
+	defer func() {
+		if err := this.VideoStack.Dispose(); err != nil && rErr == nil {
+			rErr = err
+		}
+	}()
+
 	defer func() {
 		if err := this.Signal.Dispose(); err != nil && rErr == nil {
 			rErr = err
 		}
 	}()
 
-	return this.Signal.Ensure(signal.StateOff)
+	// Disposing the signal waits until it is switched off.
+	this.Signal.Ensure(signal.StateOff)
+	return nil
 }
@@ -0,0 +1,430 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const appTestTimeline = `
+- at: 0s
+  devices:
+  - name: Microphone
+    index: 1
+- at: 10s
+  devices:
+  - name: Microphone
+    index: 1
+    sessions:
+    - identifier: zoom|815
+- at: 20s
+  devices:
+  - name: Microphone
+    index: 1
+    sessions:
+    - identifier: firefox|4711
+- at: 30s
+  devices:
+  - name: Microphone
+    index: 1
+    muted: true
+    sessions:
+    - identifier: firefox|4711
+- at: 40s
+  devices:
+  - name: Microphone
+    index: 1
+`
+
+func TestApp_Run(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		expected []signal.State
+	}{{
+		name: "all sessions",
+		expected: []signal.State{
+			signal.StateOff,
+			signal.StateOn,
+			signal.StateOn,
+			signal.StateMuted,
+			signal.StateOff,
+		},
+	}, {
+		name: "excluded identifiers",
+		args: []string{`--excludedSessionIdentifiers=^zoom\|`},
+		expected: []signal.State{
+			signal.StateOff,
+			signal.StateOff,
+			signal.StateOn,
+			signal.StateMuted,
+			signal.StateOff,
+		},
+	}, {
+		name: "included identifiers",
+		args: []string{`--includedSessionIdentifiers=^zoom\|`},
+		expected: []signal.State{
+			signal.StateOff,
+			signal.StateOn,
+			signal.StateOff,
+			signal.StateOff,
+			signal.StateOff,
+		},
+	}, {
+		name: "excluded sessions",
+		args: []string{"--excludedSessions=identifier=firefox*"},
+		expected: []signal.State{
+			signal.StateOff,
+			signal.StateOn,
+			signal.StateOff,
+			signal.StateOff,
+			signal.StateOff,
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			instance, clock, record := newAppTestInstance(t, appTestTimeline, c.args...)
+			runAppTestInstance(t, instance)
+
+			// Every step of the timeline is reported by the fake audio type
+			// and results in exactly one ensure of the signal.
+			waitForAppTestEnsures(t, record, 1)
+			for i := 2; i <= len(c.expected); i++ {
+				clock.Advance(10 * time.Second)
+				waitForAppTestEnsures(t, record, i)
+			}
+
+			if actual := appTestEnsures(t, record); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("ensured states = %v; want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func TestApp_Run_rules(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(rules, []byte(`
+- name: firefox
+  when: session.identifier startsWith "firefox|" && !device.muted
+  state: speaking
+- name: any
+  when: active
+  state: camera
+`), 0644); err != nil {
+		t.Fatalf("cannot write rules: %v", err)
+	}
+	instance, clock, record := newAppTestInstance(t, appTestTimeline, "--rules="+rules)
+	runAppTestInstance(t, instance)
+
+	expected := []signal.State{
+		signal.StateOff,
+		signal.StateCamera,
+		signal.StateSpeaking,
+		signal.StateCamera,
+		signal.StateOff,
+	}
+	waitForAppTestEnsures(t, record, 1)
+	for i := 2; i <= len(expected); i++ {
+		clock.Advance(10 * time.Second)
+		waitForAppTestEnsures(t, record, i)
+	}
+
+	if actual := appTestEnsures(t, record); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("ensured states = %v; want %v", actual, expected)
+	}
+}
+
+func TestApp_Run_refresh(t *testing.T) {
+	instance, clock, record := newAppTestInstance(t, appTestTimeline, "--refreshInterval=10ms")
+	runAppTestInstance(t, instance)
+
+	waitForAppTestEnsures(t, record, 1)
+	clock.Advance(20 * time.Second)
+	waitForAppTestEvents(t, record, func(entries []signal.RecordEntry) bool {
+		// After an update the last state has to be ensured again.
+		updates := 0
+		for i, entry := range entries {
+			if entry.Event == "update" && i+1 < len(entries) &&
+				entries[i+1].Event == "ensure" && *entries[i+1].State == signal.StateOn {
+				updates++
+			}
+		}
+		return updates >= 2
+	})
+}
+
+func TestApp_Run_checkIntervalDespiteOtherEvents(t *testing.T) {
+	instance, _, record := newAppTestInstance(t, appTestTimeline, "--refreshInterval=10ms", "--checkInterval=100ms")
+	runAppTestInstance(t, instance)
+
+	waitForAppTestEvents(t, record, func(entries []signal.RecordEntry) bool {
+		// Ensures which do not follow an update are the initial one and the
+		// ones of the checks; refreshes happen much more often than these.
+		checks := 0
+		for i, entry := range entries {
+			if entry.Event == "ensure" && i > 0 && entries[i-1].Event != "update" {
+				checks++
+			}
+		}
+		return checks >= 3
+	})
+}
+
+func TestApp_Reload_signalDoesNotFlicker(t *testing.T) {
+	instance, clock, record := newAppTestInstance(t, appTestTimeline)
+	runAppTestInstance(t, instance)
+
+	waitForAppTestEnsures(t, record, 1)
+	clock.Advance(10 * time.Second)
+	waitForAppTestEnsures(t, record, 2)
+
+	timelineFile := filepath.Join(filepath.Dir(record), "timeline.yaml")
+	candidate := configureAppTestInstance(t, timelineFile, record)
+	if err := instance.Reload(context.Background(), candidate, Changes{Signal: true}); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+
+	// Both signals address the same target, which has to stay on.
+	waitForAppTestEnsures(t, record, 3)
+	expected := []signal.State{signal.StateOff, signal.StateOn, signal.StateOn}
+	if actual := appTestEnsures(t, record); !reflect.DeepEqual(actual[:3], expected) || slices.Contains(actual[1:], signal.StateOff) {
+		t.Errorf("ensured states = %v; want %v without off", actual, expected)
+	}
+}
+
+func TestApp_Reload_doesNotWaitForHuePairing(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	instance, _, record := newAppTestInstance(t, appTestTimeline)
+	runAppTestInstance(t, instance)
+	waitForAppTestEnsures(t, record, 1)
+
+	// Not paired yet, so the link button would have to be pressed.
+	timelineFile := filepath.Join(filepath.Dir(record), "timeline.yaml")
+	candidate := configureAppTestInstance(t, timelineFile, record, "--signal.type=hue", "--signal.hue.bridge=127.0.0.1:1")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := instance.Reload(ctx, candidate, Changes{Signal: true}); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+
+	var hue *signal.Health
+	for _, v := range instance.Signal.Health() {
+		if v.Type == signal.TypeHue {
+			hue = &v
+		}
+	}
+	if hue == nil || hue.Healthy || !strings.Contains(hue.LastError, "'hue pair'") {
+		t.Errorf("health of hue = %+v; want failed pointing to 'hue pair'", hue)
+	}
+}
+
+func TestApp_Dispose(t *testing.T) {
+	instance, clock, record := newAppTestInstance(t, appTestTimeline)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- instance.Run(ctx) }()
+
+	waitForAppTestEnsures(t, record, 1)
+	clock.Advance(20 * time.Second)
+	waitForAppTestEnsures(t, record, 2)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if err := instance.Dispose(); err != nil {
+		t.Fatalf("Dispose() failed: %v", err)
+	}
+
+	entries := readAppTestRecord(t, record)
+	var events []string
+	for _, entry := range entries {
+		events = append(events, entry.Event)
+	}
+	expected := []string{"initialize", "ensure", "ensure", "ensure", "dispose"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("recorded events = %v; want %v", events, expected)
+	}
+	if last := entries[len(entries)-2]; *last.State != signal.StateOff {
+		t.Errorf("last ensured state = %v; want %v", *last.State, signal.StateOff)
+	}
+}
+
+func newAppTestInstance(t *testing.T, timeline string, args ...string) (*App, *manualClock, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	timelineFile := filepath.Join(dir, "timeline.yaml")
+	if err := os.WriteFile(timelineFile, []byte(timeline), 0644); err != nil {
+		t.Fatalf("cannot write timeline: %v", err)
+	}
+	record := filepath.Join(dir, "record.jsonl")
+
+	instance := configureAppTestInstance(t, timelineFile, record, args...)
+
+	clock := &manualClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	instance.AudioStack.Detector.(*audio.Fake).Clock = clock
+
+	if err := instance.Initialize(); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+	return instance, clock, record
+}
+
+// configureAppTestInstance creates an App which is configured but not
+// initialized yet.
+func configureAppTestInstance(t *testing.T, timelineFile, record string, args ...string) *App {
+	t.Helper()
+
+	var instance App
+	cmd := kingpin.New("test", "")
+	instance.SetupConfiguration(cmd)
+	if _, err := cmd.Parse(append([]string{
+		"--audio.type=fake",
+		"--audio.fake.timeline=" + timelineFile,
+		"--no-video.enabled",
+		"--signal.type=record",
+		"--signal.record.file=" + record,
+	}, args...)); err != nil {
+		t.Fatalf("cannot parse arguments: %v", err)
+	}
+	return &instance
+}
+
+func runAppTestInstance(t *testing.T, instance *App) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := instance.Run(ctx); err != nil {
+			t.Errorf("Run() failed: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		if err := instance.Dispose(); err != nil {
+			t.Errorf("Dispose() failed: %v", err)
+		}
+	})
+}
+
+func waitForAppTestEnsures(t *testing.T, record string, n int) {
+	t.Helper()
+	waitForAppTestEvents(t, record, func(entries []signal.RecordEntry) bool {
+		ensures := 0
+		for _, entry := range entries {
+			if entry.Event == "ensure" {
+				ensures++
+			}
+		}
+		return ensures >= n
+	})
+}
+
+func waitForAppTestEvents(t *testing.T, record string, predicate func([]signal.RecordEntry) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries := readAppTestRecord(t, record)
+		if predicate(entries) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected events not recorded; got: %+v", entries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func appTestEnsures(t *testing.T, record string) (result []signal.State) {
+	t.Helper()
+	for _, entry := range readAppTestRecord(t, record) {
+		if entry.Event == "ensure" {
+			result = append(result, *entry.State)
+		}
+	}
+	return
+}
+
+func readAppTestRecord(t *testing.T, record string) (result []signal.RecordEntry) {
+	t.Helper()
+	f, err := os.Open(record)
+	if err != nil {
+		t.Fatalf("cannot open record: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry signal.RecordEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// The line might not be written completely yet.
+			break
+		}
+		result = append(result, entry)
+	}
+	return
+}
+
+// manualClock only moves forward if Advance is called.
+type manualClock struct {
+	now     time.Time
+	waiters []manualClockWaiter
+	mutex   sync.Mutex
+}
+
+type manualClockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (this *manualClock) Now() time.Time {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.now
+}
+
+func (this *manualClock) At(t time.Time) <-chan time.Time {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if !t.After(this.now) {
+		ch <- this.now
+	} else {
+		this.waiters = append(this.waiters, manualClockWaiter{t, ch})
+	}
+	return ch
+}
+
+func (this *manualClock) Advance(d time.Duration) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.now = this.now.Add(d)
+	waiters := this.waiters[:0]
+	for _, w := range this.waiters {
+		if !w.at.After(this.now) {
+			w.ch <- this.now
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	this.waiters = waiters
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	log "github.com/echocat/slf4g"
+	"time"
+)
+
+// debounce holds what is required to delay transitions between off and any
+// other state. Transitions between two states which are not off (like on and
+// speaking) are never delayed.
+type debounce struct {
+	current        signal.State
+	onSince        time.Time
+	candidate      signal.State
+	candidateSince time.Time
+}
+
+// apply returns the state which should be signaled now given the detected
+// one. If the transition to detected was delayed, the returned duration tells
+// after which time it should be applied again.
+func (this *debounce) apply(app *App, detected signal.State, now time.Time) (signal.State, time.Duration) {
+	if detected == this.current {
+		if this.candidate != detected {
+			log.With("state", this.current).
+				With("canceled", this.candidate).
+				Info("Delayed state change canceled.")
+		}
+		this.candidate = detected
+		return this.current, 0
+	}
+	if detected != signal.StateOff && this.current != signal.StateOff {
+		this.current, this.candidate = detected, detected
+		return this.current, 0
+	}
+
+	if detected != this.candidate {
+		this.candidate = detected
+		this.candidateSince = now
+	}
+
+	var until time.Time
+	var reason string
+	if detected != signal.StateOff {
+		until, reason = this.candidateSince.Add(app.OnDelay), "onDelay"
+	} else {
+		until, reason = this.candidateSince.Add(app.OffGrace), "offGrace"
+		if v := this.onSince.Add(app.MinOnTime); v.After(until) {
+			until, reason = v, "minOnTime"
+		}
+	}
+
+	if wait := until.Sub(now); wait > 0 {
+		l := log.With("state", this.current).
+			With("detected", detected).
+			With("reason", reason).
+			With("remaining", wait)
+		if this.candidateSince.Equal(now) {
+			l.Info("State change delayed.")
+		} else {
+			l.Debug("State change still delayed.")
+		}
+		return this.current, wait
+	}
+
+	if detected != signal.StateOff {
+		this.onSince = now
+	}
+	this.current = detected
+	return this.current, 0
+}
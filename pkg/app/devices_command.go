@@ -0,0 +1,91 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alecthomas/kingpin/v2"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// DevicesCommand prints all devices and their sessions once, including
+// whether each session passes the configured filters.
+type DevicesCommand struct {
+	App    *App
+	Format string
+}
+
+func (this *DevicesCommand) SetupConfiguration(app *kingpin.Application) {
+	cmd := app.Command("devices", "Finds all audio and video devices and their sessions once and prints them, including whether each session passes the configured filters and why.").
+		Action(func(*kingpin.ParseContext) error {
+			return this.run(os.Stdout)
+		})
+	cmd.Flag("format", "Output format. Possible values: table, json, yaml").
+		Short('o').
+		Default("table").
+		EnumVar(&this.Format, "table", "json", "yaml")
+}
+
+func (this *DevicesCommand) run(to io.Writer) error {
+	inspection, err := this.App.Inspect()
+	if err != nil {
+		return err
+	}
+
+	switch this.Format {
+	case "json":
+		encoder := json.NewEncoder(to)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(inspection)
+	case "yaml":
+		encoder := yaml.NewEncoder(to)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(inspection); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return this.printTable(inspection, to)
+	}
+}
+
+func (this *DevicesCommand) printTable(inspection Inspection, to io.Writer) error {
+	w := tabwriter.NewWriter(to, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KIND\tDEVICE\tPID\tPROCESS\tUSER\tMUTED\tPEAK\tRELEVANT\tREASON\tIDENTIFIER")
+	for _, device := range inspection.Devices {
+		if len(device.Sessions) == 0 {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t\t\t\t%s\t\t\t\t\n", device.Kind, device.Name, yesNo(device.Muted))
+			continue
+		}
+		for _, session := range device.Sessions {
+			var peak string
+			if session.Peak > 0 {
+				peak = strconv.FormatFloat(float64(session.Peak), 'f', 2, 32)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				device.Kind,
+				device.Name,
+				session.HolderPid,
+				session.ProcessName,
+				session.User,
+				yesNo(device.Muted || session.Muted),
+				peak,
+				yesNo(session.Relevant),
+				session.Reason,
+				session.Identifier,
+			)
+		}
+	}
+	_, _ = fmt.Fprintf(w, "\nDetected state: %v\n", inspection.State)
+	return w.Flush()
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
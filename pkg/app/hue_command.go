@@ -0,0 +1,127 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// HueCommand provides the administration of the hue signal: pairing and
+// listing or identifying the lights and groups of the bridge.
+type HueCommand struct {
+	App *App
+
+	Format           string
+	Name             string
+	IdentifyDuration time.Duration
+}
+
+func (this *HueCommand) SetupConfiguration(app *kingpin.Application) {
+	cmd := app.Command("hue", "Administrate the hue bridge.")
+
+	cmd.Command("pair", "Pairs with the hue bridge (press its link button) and persists the credentials, even if already paired.").
+		Action(func(*kingpin.ParseContext) error {
+			credentials, err := this.hue().PairBridge()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(os.Stdout, "Paired with bridge %s.\n", credentials.Host)
+			return err
+		})
+	cmd.Command("unpair", "Removes the persisted credentials of the hue bridge.").
+		Action(func(*kingpin.ParseContext) error {
+			credentials, err := this.hue().UnpairBridge()
+			if err != nil {
+				return err
+			}
+			if credentials.IsZero() {
+				_, err = fmt.Fprintln(os.Stdout, "Was not paired.")
+			} else {
+				_, err = fmt.Fprintf(os.Stdout, "Unpaired from bridge %s.\n", credentials.Host)
+			}
+			return err
+		})
+
+	lights := cmd.Command("lights", "Lists all lights of the hue bridge and whether they match signal.hue.name and signal.hue.kind.").
+		Action(func(*kingpin.ParseContext) error {
+			return this.list(signal.HueKindLight, os.Stdout)
+		})
+	groups := cmd.Command("groups", "Lists all groups of the hue bridge and whether they match signal.hue.name and signal.hue.kind.").
+		Action(func(*kingpin.ParseContext) error {
+			return this.list(signal.HueKindGroup, os.Stdout)
+		})
+	for _, c := range []*kingpin.CmdClause{lights, groups} {
+		c.Flag("format", "Output format. Possible values: table, json, yaml").
+			Short('o').
+			Default("table").
+			EnumVar(&this.Format, "table", "json", "yaml")
+	}
+
+	identify := cmd.Command("identify", "Lets all lights and groups with the given name or ID blink. Those which were off are switched off again afterwards.").
+		Action(func(*kingpin.ParseContext) error {
+			if _, err := fmt.Fprintf(os.Stdout, "Let %q blink for %v...\n", this.Name, this.IdentifyDuration); err != nil {
+				return err
+			}
+			entries, err := this.hue().Identify(this.Name, this.IdentifyDuration)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if _, err := fmt.Fprintf(os.Stdout, "Identified %v %q#%d.\n", entry.Kind, entry.Name, entry.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	identify.Arg("name", "Name (case-insensitive) or ID of the light or group.").
+		Required().
+		StringVar(&this.Name)
+	identify.Flag("duration", "How long the lights should blink.").
+		Default("15s").
+		DurationVar(&this.IdentifyDuration)
+}
+
+func (this *HueCommand) hue() *signal.Hue {
+	return this.App.Signal.Variant(signal.TypeHue).(*signal.Hue)
+}
+
+func (this *HueCommand) list(kind signal.HueKind, to io.Writer) error {
+	entries, err := this.hue().Entries(kind)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []signal.HueEntry{}
+	}
+
+	switch this.Format {
+	case "json":
+		encoder := json.NewEncoder(to)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "yaml":
+		encoder := yaml.NewEncoder(to)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(entries); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	w := tabwriter.NewWriter(to, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tNAME\tTYPE\tON\tREACHABLE\tMATCHES")
+	for _, entry := range entries {
+		reachable := "-"
+		if v := entry.Reachable; v != nil {
+			reachable = yesNo(*v)
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", entry.ID, entry.Name, entry.Type, yesNo(entry.On), reachable, yesNo(entry.Matches))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+)
+
+// Inspection is the result of a single lookup of all devices and their
+// sessions, judged by the configured filters.
+type Inspection struct {
+	// State is the state which would be detected from Devices.
+	State   signal.State      `json:"state" yaml:"state"`
+	Devices []InspectedDevice `json:"devices" yaml:"devices"`
+}
+
+type InspectedDevice struct {
+	// Kind is either audio or video.
+	Kind     string             `json:"kind" yaml:"kind"`
+	Name     string             `json:"name" yaml:"name"`
+	Index    uint32             `json:"index" yaml:"index"`
+	Muted    bool               `json:"muted,omitempty" yaml:"muted,omitempty"`
+	Sessions []InspectedSession `json:"sessions" yaml:"sessions"`
+}
+
+type InspectedSession struct {
+	audio.Session `yaml:",inline"`
+	Verdict       `yaml:",inline"`
+}
+
+// Inspect initializes the audio and video stacks, finds all devices once and
+// disposes the stacks again. Signals are not touched.
+func (this *App) Inspect() (result Inspection, rErr error) {
+	this.ensure()
+
+	if err := this.loadRules(); err != nil {
+		return Inspection{}, err
+	}
+	if err := this.AudioStack.Initialize(); err != nil {
+		return Inspection{}, err
+	}
+	defer func() {
+		if err := this.AudioStack.Dispose(); err != nil && rErr == nil {
+			rErr = err
+		}
+	}()
+	if err := this.VideoStack.Initialize(); err != nil {
+		return Inspection{}, err
+	}
+	defer func() {
+		if err := this.VideoStack.Dispose(); err != nil && rErr == nil {
+			rErr = err
+		}
+	}()
+
+	audioDevices, err := this.AudioStack.FindDevices()
+	if err != nil {
+		return Inspection{}, err
+	}
+	videoDevices, err := this.VideoStack.FindDevices()
+	if err != nil {
+		return Inspection{}, err
+	}
+
+	result.State = this.evaluate(audioDevices, videoDevices)
+	result.Devices = append(this.inspect("audio", audioDevices), this.inspect("video", videoDevices)...)
+	return result, nil
+}
+
+func (this *App) inspect(kind string, devices audio.Devices) []InspectedDevice {
+	result := make([]InspectedDevice, len(devices))
+	for i, device := range devices {
+		result[i] = InspectedDevice{
+			Kind:     kind,
+			Name:     device.Name,
+			Index:    device.Index,
+			Muted:    device.Muted,
+			Sessions: make([]InspectedSession, len(device.Sessions)),
+		}
+		for j, session := range device.Sessions {
+			result[i].Sessions[j] = InspectedSession{session, this.judge(&session)}
+		}
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"github.com/blaubaer/talk-indicator/pkg/metrics"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+)
+
+// observe records the result of an evaluation at the metrics.
+func (this *App) observe(from, to signal.State, audioDevices, videoDevices audio.Devices) {
+	for _, candidate := range signal.AllStates {
+		v := 0.0
+		if candidate == to {
+			v = 1
+		}
+		metrics.State.WithLabelValues(candidate.String()).Set(v)
+	}
+	if from != to {
+		metrics.StateTransitions.WithLabelValues(from.String(), to.String()).Inc()
+	}
+	if this.override != nil {
+		metrics.Overridden.Set(1)
+	} else {
+		metrics.Overridden.Set(0)
+	}
+
+	metrics.ActiveSessions.Reset()
+	observeSessions := func(kind string, devices audio.Devices) {
+		for _, device := range devices {
+			n := 0
+			for _, session := range device.Sessions {
+				if this.isRelevant(&session) {
+					n++
+				}
+			}
+			metrics.ActiveSessions.WithLabelValues(kind, device.Name).Set(float64(n))
+		}
+	}
+	observeSessions("audio", audioDevices)
+	observeSessions("video", videoDevices)
+}
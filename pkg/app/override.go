@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	log "github.com/echocat/slf4g"
+	"time"
+)
+
+// Override pins the signaled State regardless of what is detected, either
+// until it is cleared or (if set) until Until.
+type Override struct {
+	State signal.State `json:"state" yaml:"state"`
+	Since time.Time    `json:"since" yaml:"since"`
+	Until *time.Time   `json:"until,omitempty" yaml:"until,omitempty"`
+}
+
+// NewOverride creates a new Override for the given state. If duration is not
+// positive the Override lasts until it is cleared.
+func NewOverride(state signal.State, duration time.Duration) *Override {
+	result := &Override{
+		State: state,
+		Since: time.Now(),
+	}
+	if duration > 0 {
+		until := result.Since.Add(duration)
+		result.Until = &until
+	}
+	return result
+}
+
+// SetOverride sets the given Override at this running instance. nil clears
+// the current one and returns to the detected state.
+func (this *App) SetOverride(ctx context.Context, v *Override) error {
+	this.ensure()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case this.overrides <- v:
+		return nil
+	}
+}
+
+// applyOverride activates v and returns the channel which fires when it
+// expires (nil if it never expires).
+func (this *App) applyOverride(v *Override) <-chan time.Time {
+	this.override = v
+	this.updateStatus(func(status *Status) {
+		status.Override = v
+	})
+
+	if v == nil {
+		return nil
+	}
+
+	l := log.With("state", v.State)
+	if v.Until == nil {
+		l.Info("Override set.")
+		return nil
+	}
+	l.With("until", *v.Until).
+		Info("Override set.")
+	return time.After(time.Until(*v.Until))
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	log "github.com/echocat/slf4g"
+)
+
+// Changes tells which parts of the configuration of a candidate passed to
+// App.Reload differ from the one which is currently running. Only these parts
+// are replaced by the ones of the candidate; all others are kept as they are.
+type Changes struct {
+	Audio  bool
+	Video  bool
+	Signal bool
+}
+
+type reload struct {
+	candidate *App
+	changes   Changes
+	result    chan error
+}
+
+// Reload applies the configuration of the given candidate (which has to be
+// configured but not initialized) to this instance while it is running. If
+// anything of the candidate cannot be initialized the running configuration
+// stays untouched and the error is returned.
+func (this *App) Reload(ctx context.Context, candidate *App, changes Changes) error {
+	this.ensure()
+	candidate.ensure()
+
+	r := reload{candidate, changes, make(chan error, 1)}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case this.reloads <- r:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-r.result:
+		return err
+	}
+}
+
+func (this *App) reload(candidate *App, changes Changes, lastState *signal.State) error {
+	if err := candidate.prepareReload(changes); err != nil {
+		return err
+	}
+
+	this.CheckInterval = candidate.CheckInterval
+	this.RefreshInterval = candidate.RefreshInterval
+	this.IncludedSessionIdentifiers = candidate.IncludedSessionIdentifiers
+	this.ExcludedSessionIdentifiers = candidate.ExcludedSessionIdentifiers
+	this.IncludedSessions = candidate.IncludedSessions
+	this.ExcludedSessions = candidate.ExcludedSessions
+	this.SpeakingThreshold = candidate.SpeakingThreshold
+	this.OnDelay = candidate.OnDelay
+	this.OffGrace = candidate.OffGrace
+	this.MinOnTime = candidate.MinOnTime
+	this.RulesFile = candidate.RulesFile
+	this.rules = candidate.rules
+
+	if changes.Audio {
+		old := this.AudioStack
+		this.AudioStack = candidate.AudioStack
+		if err := old.Dispose(); err != nil {
+			log.WithError(err).
+				Warn("Cannot dispose replaced audio stack.")
+		}
+	}
+	if changes.Video {
+		old := this.VideoStack
+		this.VideoStack = candidate.VideoStack
+		if err := old.Dispose(); err != nil {
+			log.WithError(err).
+				Warn("Cannot dispose replaced video stack.")
+		}
+	}
+	if changes.Signal {
+		old := this.Signal
+		this.Signal = candidate.Signal
+		// The new signal takes over first, so targets addressed by both do
+		// not flicker. The replaced signal might address other lights (or
+		// topics, ...) which would stay on forever otherwise.
+		if lastState != nil {
+			this.Signal.Ensure(*lastState)
+			if *lastState != signal.StateOff {
+				if err := old.Release(this.Signal); err != nil {
+					log.WithError(err).
+						Warn("Cannot switch off targets of replaced signal.")
+				}
+			}
+		}
+		if err := old.Dispose(); err != nil {
+			log.WithError(err).
+				Warn("Cannot dispose replaced signal.")
+		}
+	} else if err := this.Signal.Update(); err != nil {
+		log.WithError(err).
+			Error("Cannot update signal.")
+	}
+
+	log.With("audio", changes.Audio).
+		With("video", changes.Video).
+		With("signal", changes.Signal).
+		Info("Configuration reloaded.")
+	return nil
+}
+
+// prepareReload initializes everything of this candidate which will replace
+// the running one. Contrary to Initialize() it never switches the signal off
+// on failures as the running signal could share the same lights.
+func (this *App) prepareReload(changes Changes) error {
+	var initialized []func() error
+	success := false
+	defer func() {
+		if !success {
+			for _, dispose := range initialized {
+				if err := dispose(); err != nil {
+					log.WithError(err).
+						Warn("Cannot dispose candidate of configuration reload.")
+				}
+			}
+		}
+	}()
+
+	if err := this.loadRules(); err != nil {
+		return err
+	}
+	if changes.Audio {
+		if err := this.AudioStack.Initialize(); err != nil {
+			return fmt.Errorf("cannot initialize audio stack: %w", err)
+		}
+		initialized = append(initialized, this.AudioStack.Dispose)
+	}
+	if changes.Video {
+		if err := this.VideoStack.Initialize(); err != nil {
+			return fmt.Errorf("cannot initialize video stack: %w", err)
+		}
+		initialized = append(initialized, this.VideoStack.Dispose)
+	}
+	if changes.Signal {
+		if v, ok := this.Signal.Variant(signal.TypeHue).(*signal.Hue); ok {
+			// Waiting for the link button would block the running app.
+			v.Unattended = true
+		}
+		if err := this.Signal.Initialize(); err != nil {
+			// Signals might be partially initialized.
+			initialized = append(initialized, this.Signal.Dispose)
+			return fmt.Errorf("cannot initialize signal: %w", err)
+		}
+		initialized = append(initialized, this.Signal.Dispose)
+	}
+
+	success = true
+	return nil
+}
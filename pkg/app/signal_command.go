@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SignalTestCommand initializes the configured signals and applies states to
+// them without any detection.
+type SignalTestCommand struct {
+	App *App
+
+	Action string
+	Pause  time.Duration
+}
+
+func (this *SignalTestCommand) SetupConfiguration(app *kingpin.Application) {
+	cmd := app.Command("signal", "Work with the configured signals.").
+		Command("test", "Initializes the configured signals and applies the given state to them (or cycles through all states) without any detection. Fails if any target failed.").
+		Action(func(*kingpin.ParseContext) error {
+			return this.run(os.Stdout)
+		})
+	cmd.Arg("action", fmt.Sprintf("State to apply (%v) or cycle.", signal.AllStates)).
+		Required().
+		StringVar(&this.Action)
+	cmd.Flag("pause", "How long each state is shown while cycling.").
+		Default("3s").
+		DurationVar(&this.Pause)
+}
+
+func (this *SignalTestCommand) run(to io.Writer) (rErr error) {
+	var states []signal.State
+	if strings.EqualFold(strings.TrimSpace(this.Action), "cycle") {
+		for _, state := range signal.AllStates {
+			if state != signal.StateOff {
+				states = append(states, state)
+			}
+		}
+		states = append(states, signal.StateOff)
+	} else {
+		var state signal.State
+		if err := state.Set(this.Action); err != nil {
+			return err
+		}
+		states = append(states, state)
+	}
+
+	facade := this.App.Signal
+	if err := facade.Initialize(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := facade.Dispose(); err != nil && rErr == nil {
+			rErr = err
+		}
+	}()
+
+	w := tabwriter.NewWriter(to, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RESULT\tSIGNAL\tTARGET\tSTATE\tERROR")
+	var total, failed int
+	for i, state := range states {
+		if i > 0 {
+			_ = w.Flush()
+			time.Sleep(this.Pause)
+		}
+		for _, r := range facade.EnsureTargets(state) {
+			total++
+			if r.Error != nil {
+				failed++
+				_, _ = fmt.Fprintf(w, "failed\t%v\t%s\t%v\t%v\n", r.Type, r.Target, state, r.Error)
+			} else {
+				_, _ = fmt.Fprintf(w, "ok\t%v\t%s\t%v\t\n", r.Type, r.Target, state)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, total)
+	}
+	return nil
+}
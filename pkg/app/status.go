@@ -0,0 +1,41 @@
+package app
+
+import (
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	"time"
+)
+
+// Status describes what a running App currently knows.
+type Status struct {
+	// State is the state which is currently signaled.
+	State signal.State `json:"state" yaml:"state"`
+	// Detected is the state which was detected from the sessions. It differs
+	// from State while a transition is delayed.
+	Detected signal.State `json:"detected" yaml:"detected"`
+	// Since is the time State was signaled first.
+	Since *time.Time `json:"since,omitempty" yaml:"since,omitempty"`
+	// Checked is the time of the latest evaluation.
+	Checked *time.Time `json:"checked,omitempty" yaml:"checked,omitempty"`
+	// Override is the currently active Override, if any.
+	Override *Override `json:"override,omitempty" yaml:"override,omitempty"`
+
+	AudioDevices audio.Devices   `json:"audioDevices" yaml:"audioDevices"`
+	VideoDevices audio.Devices   `json:"videoDevices" yaml:"videoDevices"`
+	Signals      []signal.Health `json:"signals" yaml:"signals"`
+}
+
+// Status returns a snapshot of the current Status of this instance.
+func (this *App) Status() Status {
+	this.ensure()
+	this.statusMutex.RLock()
+	defer this.statusMutex.RUnlock()
+	return this.status
+}
+
+func (this *App) updateStatus(modifier func(*Status)) {
+	this.statusMutex.Lock()
+	defer this.statusMutex.Unlock()
+	modifier(&this.status)
+	this.status.Signals = this.Signal.Health()
+}
@@ -0,0 +1,23 @@
+package audio
+
+import "github.com/blaubaer/talk-indicator/pkg/common"
+
+type Alsa struct{}
+
+func (this *Alsa) SetupConfiguration(_ common.FlagHolder) {}
+
+func (this *Alsa) Initialize() error {
+	return nil
+}
+
+func (this *Alsa) Dispose() error {
+	return nil
+}
+
+func (this *Alsa) FindDevices() (Devices, error) {
+	return findAlsaDevices()
+}
+
+func (this *Alsa) GetType() Type {
+	return TypeAlsa
+}
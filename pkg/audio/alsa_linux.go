@@ -0,0 +1,199 @@
+package audio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const procAsound = "/proc/asound"
+
+var (
+	alsaCardLinePattern    = regexp.MustCompile(`^\s*(\d+)\s+\[([^]]*)]\s*:\s*(.*)$`)
+	alsaCaptureDirPattern  = regexp.MustCompile(`^card(\d+)/pcm(\d+)c$`)
+	alsaSubstreamPattern   = regexp.MustCompile(`^sub(\d+)$`)
+	alsaStatusFieldPattern = regexp.MustCompile(`^\s*([a-z_]+)\s*:\s*(.*)$`)
+)
+
+func findAlsaDevices() (result Devices, _ error) {
+	cardNames, err := readAlsaCardNames()
+	if err != nil {
+		return nil, err
+	}
+
+	captureDirs, err := filepath.Glob(filepath.Join(procAsound, "card*", "pcm*c"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list capture PCMs of %s: %w", procAsound, err)
+	}
+	sort.Strings(captureDirs)
+
+	for _, captureDir := range captureDirs {
+		rel, err := filepath.Rel(procAsound, captureDir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve capture PCM %s: %w", captureDir, err)
+		}
+		m := alsaCaptureDirPattern.FindStringSubmatch(filepath.ToSlash(rel))
+		if m == nil {
+			continue
+		}
+		card, _ := strconv.Atoi(m[1])
+		pcm, _ := strconv.Atoi(m[2])
+
+		device, err := introspectAlsaCapture(captureDir, card, pcm, cardNames[card], uint32(len(result)))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, device)
+	}
+
+	return
+}
+
+func readAlsaCardNames() (map[int]string, error) {
+	f, err := os.Open(filepath.Join(procAsound, "cards"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[int]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ALSA cards: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	result := map[int]string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		m := alsaCardLinePattern.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+		card, _ := strconv.Atoi(m[1])
+		name := strings.TrimSpace(m[3])
+		if i := strings.Index(name, " - "); i >= 0 {
+			name = strings.TrimSpace(name[i+3:])
+		}
+		if name == "" {
+			name = strings.TrimSpace(m[2])
+		}
+		result[card] = name
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read ALSA cards: %w", err)
+	}
+	return result, nil
+}
+
+func introspectAlsaCapture(captureDir string, card, pcm int, cardName string, deviceIndex uint32) (Device, error) {
+	info, err := readAlsaFields(filepath.Join(captureDir, "info"))
+	if err != nil {
+		return Device{}, err
+	}
+
+	name := cardName
+	if v := info["name"]; v != "" {
+		if name == "" {
+			name = v
+		} else {
+			name = name + ": " + v
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("hw:%d,%d", card, pcm)
+	}
+
+	device := Device{
+		Name:  name,
+		Index: deviceIndex,
+	}
+
+	if sessions, err := device.getAlsaSessionsOf(captureDir, card, pcm); err != nil {
+		return Device{}, err
+	} else {
+		device.Sessions = sessions
+	}
+
+	return device, nil
+}
+
+func (this Device) getAlsaSessionsOf(captureDir string, card, pcm int) (result Sessions, _ error) {
+	entries, err := os.ReadDir(captureDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get substreams of device %v: %w", this, err)
+	}
+
+	for _, entry := range entries {
+		m := alsaSubstreamPattern.FindStringSubmatch(entry.Name())
+		if m == nil || !entry.IsDir() {
+			continue
+		}
+		sub, _ := strconv.Atoi(m[1])
+
+		session, ok, err := this.introspectAlsaSubstream(filepath.Join(captureDir, entry.Name()), card, pcm, sub)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, session)
+		}
+	}
+	return
+}
+
+func (this Device) introspectAlsaSubstream(dir string, card, pcm, sub int) (Session, bool, error) {
+	status, err := readAlsaFields(filepath.Join(dir, "status"))
+	if err != nil {
+		return Session{}, false, fmt.Errorf("cannot get status of substream %d of device %v: %w", sub, this, err)
+	}
+
+	// A closed substream only contains the single word "closed" and therefore has no fields at all.
+	if !strings.EqualFold(status["state"], "RUNNING") {
+		return Session{}, false, nil
+	}
+
+	var s Session
+	if v := status["owner_pid"]; v != "" {
+		pid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return Session{}, false, fmt.Errorf("illegal owner_pid of substream %d of device %v: %s", sub, this, v)
+		}
+		s.HolderPid = uint32(pid)
+	}
+
+	s.Identifier = fmt.Sprintf("hw:%d,%d,%d", card, pcm, sub)
+	if s.HolderPid > 0 {
+		if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", s.HolderPid)); err == nil {
+			s.Identifier += "|" + exe
+		}
+	}
+
+	return s, true, nil
+}
+
+func readAlsaFields(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", file, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	result := map[string]string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if m := alsaStatusFieldPattern.FindStringSubmatch(s.Text()); m != nil {
+			result[m[1]] = strings.TrimSpace(m[2])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", file, err)
+	}
+	return result, nil
+}
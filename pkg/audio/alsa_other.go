@@ -0,0 +1,9 @@
+//go:build !linux
+
+package audio
+
+import "fmt"
+
+func findAlsaDevices() (Devices, error) {
+	return nil, fmt.Errorf("audio type %v is only supported on Linux", TypeAlsa)
+}
@@ -0,0 +1,12 @@
+package audio
+
+import "github.com/blaubaer/talk-indicator/pkg/common"
+
+type Detector interface {
+	SetupConfiguration(common.FlagHolder)
+	Initialize() error
+	Dispose() error
+	FindDevices() (Devices, error)
+
+	GetType() Type
+}
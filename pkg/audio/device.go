@@ -5,9 +5,10 @@ import (
 )
 
 type Device struct {
-	Name     string   `json:"name"`
-	Index    uint32   `json:"index"`
-	Sessions Sessions `json:"sessions,omitempty"`
+	Name     string   `json:"name" yaml:"name"`
+	Index    uint32   `json:"index" yaml:"index"`
+	Muted    bool     `json:"muted,omitempty" yaml:"muted,omitempty"`
+	Sessions Sessions `json:"sessions,omitempty" yaml:"sessions,omitempty"`
 }
 
 func (this Device) String() string {
@@ -28,6 +29,20 @@ func (this Devices) HasContent() bool {
 	return !this.IsZero()
 }
 
+// Clone returns a deep copy, which can be modified without affecting this
+// instance.
+func (this Devices) Clone() Devices {
+	if this == nil {
+		return nil
+	}
+	result := make(Devices, len(this))
+	for i, v := range this {
+		result[i] = v
+		result[i].Sessions = v.Sessions.Clone()
+	}
+	return result
+}
+
 func (this Devices) HasRelevantSession(predicate func(*Session) bool) bool {
 	for _, v := range this {
 		if v.HasRelevantSession(predicate) {
@@ -4,9 +4,10 @@ import (
 	"fmt"
 	"github.com/go-ole/go-ole"
 	"github.com/moutend/go-wca/pkg/wca"
+	"time"
 )
 
-func findDevices() (Devices, error) {
+func findWasapiDevices(peakWindow, peakInterval time.Duration) (Devices, error) {
 	if err := ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED); err != nil {
 		panic(err) // Incorrect function.
 	}
@@ -18,10 +19,18 @@ func findDevices() (Devices, error) {
 	}
 	defer de.Release()
 
-	return introspectDevicesOf(de)
+	var meters sessionPeakMeters
+	defer meters.release()
+
+	result, err := introspectDevicesOf(de, &meters)
+	if err != nil {
+		return nil, err
+	}
+	meters.sample(result, peakWindow, peakInterval)
+	return result, nil
 }
 
-func introspectDevicesOf(enumerator *wca.IMMDeviceEnumerator) (result Devices, _ error) {
+func introspectDevicesOf(enumerator *wca.IMMDeviceEnumerator, meters *sessionPeakMeters) (result Devices, _ error) {
 	var collection *wca.IMMDeviceCollection
 	if err := enumerator.EnumAudioEndpoints(wca.ECapture, wca.DEVICE_STATE_ACTIVE, &collection); err != nil {
 		return nil, fmt.Errorf("cannot query IMMDevices: %w", err)
@@ -34,7 +43,7 @@ func introspectDevicesOf(enumerator *wca.IMMDeviceEnumerator) (result Devices, _
 	}
 
 	for i := uint32(0); i < count; i++ {
-		device, err := introspectDeviceOf(collection, i)
+		device, err := introspectDeviceOf(collection, i, meters)
 		if err != nil {
 			return nil, err
 		}
@@ -44,17 +53,17 @@ func introspectDevicesOf(enumerator *wca.IMMDeviceEnumerator) (result Devices, _
 	return
 }
 
-func introspectDeviceOf(collection *wca.IMMDeviceCollection, deviceIndex uint32) (Device, error) {
+func introspectDeviceOf(collection *wca.IMMDeviceCollection, deviceIndex uint32, meters *sessionPeakMeters) (Device, error) {
 	var device *wca.IMMDevice
 	if err := collection.Item(deviceIndex, &device); err != nil {
 		return Device{}, fmt.Errorf("cannot get item %d of IMMDevice collection: %w", deviceIndex, err)
 	}
 	defer device.Release()
 
-	return introspectDevice(device, deviceIndex)
+	return introspectDevice(device, deviceIndex, meters)
 }
 
-func introspectDevice(captureDevice *wca.IMMDevice, deviceIndex uint32) (Device, error) {
+func introspectDevice(captureDevice *wca.IMMDevice, deviceIndex uint32, meters *sessionPeakMeters) (Device, error) {
 	var propertyStore *wca.IPropertyStore
 	if err := captureDevice.OpenPropertyStore(wca.STGM_READ, &propertyStore); err != nil {
 		return Device{}, fmt.Errorf("cannot get properties of device %d of IMMDevice collection: %w", deviceIndex, err)
@@ -77,7 +86,17 @@ func introspectDevice(captureDevice *wca.IMMDevice, deviceIndex uint32) (Device,
 		Index: deviceIndex,
 	}
 
-	if sessions, err := device.getSessionsOfDevice(sessionManager); err != nil {
+	var endpointVolume *wca.IAudioEndpointVolume
+	if err := captureDevice.Activate(wca.IID_IAudioEndpointVolume, wca.CLSCTX_ALL, nil, &endpointVolume); err != nil {
+		return Device{}, fmt.Errorf("cannot get volume of device %d of IMMDevice collection: %w", deviceIndex, err)
+	}
+	defer endpointVolume.Release()
+
+	if err := endpointVolume.GetMute(&device.Muted); err != nil {
+		return Device{}, fmt.Errorf("cannot get mute state of device %d of IMMDevice collection: %w", deviceIndex, err)
+	}
+
+	if sessions, err := device.getSessionsOfDevice(sessionManager, meters); err != nil {
 		return Device{}, err
 	} else {
 		device.Sessions = sessions
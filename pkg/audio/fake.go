@@ -0,0 +1,186 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake replays a timeline of devices read from a file. It is meant to drive
+// the whole application without any real audio hardware; for example in tests.
+type Fake struct {
+	Timeline string
+	Loop     time.Duration
+
+	// Clock drives the timeline. If nil the common.SystemClock is used.
+	Clock common.Clock
+
+	steps   FakeSteps
+	started time.Time
+	mutex   sync.Mutex
+}
+
+// FakeStep describes which devices (including their sessions) are present
+// starting At the given offset after the Fake was initialized - until the
+// next step starts. If Error is set, FindDevices will fail with this message.
+type FakeStep struct {
+	At      time.Duration `json:"at" yaml:"at"`
+	Devices Devices       `json:"devices,omitempty" yaml:"devices,omitempty"`
+	Error   string        `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type FakeSteps []FakeStep
+
+func (this *Fake) SetupConfiguration(using common.FlagHolder) {
+	using.Flag("audio.fake.timeline", "YAML or JSON file containing a list of steps (at, devices, error) which should be replayed by the fake audio type.").
+		Envar("TI_AUDIO_FAKE_TIMELINE").
+		StringVar(&this.Timeline)
+	using.Flag("audio.fake.loop", "If set the timeline of the fake audio type will be restarted after this duration.").
+		Envar("TI_AUDIO_FAKE_LOOP").
+		Default("0s").
+		DurationVar(&this.Loop)
+}
+
+func (this *Fake) Initialize() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	steps, err := this.readTimeline()
+	if err != nil {
+		return err
+	}
+
+	this.steps = steps
+	this.started = this.clock().Now()
+	return nil
+}
+
+func (this *Fake) readTimeline() (FakeSteps, error) {
+	if this.Timeline == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(this.Timeline)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read fake audio timeline %s: %w", this.Timeline, err)
+	}
+
+	var result FakeSteps
+	// JSON is a subset of YAML, so this covers both formats.
+	if err := yaml.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("cannot parse fake audio timeline %s: %w", this.Timeline, err)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].At < result[j].At
+	})
+
+	return result, nil
+}
+
+func (this *Fake) Dispose() error {
+	return nil
+}
+
+func (this *Fake) FindDevices() (Devices, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	step := this.stepAt(this.clock().Now().Sub(this.started))
+	if step == nil {
+		return nil, nil
+	}
+	if step.Error != "" {
+		return nil, errors.New(step.Error)
+	}
+	// The callers (like Stack.FindDevices) modify the devices, which must not
+	// change the timeline itself.
+	return step.Devices.Clone(), nil
+}
+
+func (this *Fake) stepAt(elapsed time.Duration) *FakeStep {
+	if v := this.Loop; v > 0 {
+		elapsed = elapsed % v
+	}
+	var result *FakeStep
+	for i, candidate := range this.steps {
+		if candidate.At > elapsed {
+			break
+		}
+		result = &this.steps[i]
+	}
+	return result
+}
+
+// Notify reports every time the next step of the timeline starts.
+func (this *Fake) Notify(ctx context.Context) (<-chan struct{}, error) {
+	reported, _, _ := this.nextStep()
+	result := make(chan struct{})
+	go func() {
+		defer close(result)
+		for {
+			current, next, ok := this.nextStep()
+			if !current.Equal(reported) {
+				reported = current
+				select {
+				case <-ctx.Done():
+					return
+				case result <- struct{}{}:
+				}
+				continue
+			}
+			if !ok {
+				<-ctx.Done()
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-this.clock().At(next):
+			}
+		}
+	}()
+	return result, nil
+}
+
+// nextStep returns when the current step of the timeline started and when the
+// next one will start. Both are based on the same reading of the clock, so
+// nothing can be missed while waiting for the next step.
+func (this *Fake) nextStep() (current time.Time, next time.Time, ok bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	elapsed := this.clock().Now().Sub(this.started)
+	base, position := this.started, elapsed
+	if v := this.Loop; v > 0 {
+		cycles := elapsed / v
+		base, position = this.started.Add(cycles*v), elapsed-cycles*v
+	}
+	current = base
+	for _, candidate := range this.steps {
+		if candidate.At > position {
+			return current, base.Add(candidate.At), true
+		}
+		current = base.Add(candidate.At)
+	}
+	if v := this.Loop; v > 0 {
+		return current, base.Add(v), true
+	}
+	return current, time.Time{}, false
+}
+
+func (this *Fake) clock() common.Clock {
+	if v := this.Clock; v != nil {
+		return v
+	}
+	return common.SystemClock
+}
+
+func (this *Fake) GetType() Type {
+	return TypeFake
+}
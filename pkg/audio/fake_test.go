@@ -0,0 +1,56 @@
+package audio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFake_FindDevices_doesNotModifyTimeline(t *testing.T) {
+	timeline := filepath.Join(t.TempDir(), "timeline.yaml")
+	if err := os.WriteFile(timeline, []byte(fmt.Sprintf(`
+- at: 0s
+  devices:
+  - name: Microphone
+    index: 1
+    sessions:
+    - identifier: '{0.0.1.00000000}.{a1b2}|\Device\HarddiskVolume3\zoom.exe%%b{c3d4}'
+      pid: %d
+`, os.Getpid())), 0644); err != nil {
+		t.Fatalf("cannot write timeline: %v", err)
+	}
+	fake := &Fake{Timeline: timeline}
+	if err := fake.Initialize(); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+	stack := &Stack{PollInterval: time.Second}
+	stack.ensure()
+	stack.Detector = fake
+
+	expected := Devices{{
+		Name:  "Microphone",
+		Index: 1,
+		Sessions: Sessions{{
+			Identifier: `{0.0.1.00000000}.{a1b2}|\Device\HarddiskVolume3\zoom.exe%b{c3d4}`,
+			HolderPid:  uint32(os.Getpid()),
+		}},
+	}}
+
+	actual, err := stack.FindDevices()
+	if err != nil {
+		t.Fatalf("FindDevices() failed: %v", err)
+	}
+	if actual[0].Sessions[0].IdentifierParts == nil || actual[0].Sessions[0].ProcessName == "" {
+		t.Errorf("FindDevices() = %+v; want identifier and process resolved", actual)
+	}
+	actual[0].Sessions[0].Muted = true
+
+	// Neither the resolving of the stack nor the modification of the caller
+	// ends up in the timeline.
+	if !reflect.DeepEqual(fake.steps[0].Devices, expected) {
+		t.Errorf("timeline = %+v; want %+v", fake.steps[0].Devices, expected)
+	}
+}
@@ -0,0 +1,13 @@
+package audio
+
+import "context"
+
+// Notifier is implemented by Detector variants which are able to tell on
+// their own when their devices or sessions might have changed. Detectors
+// which do not implement it will be polled by Stack.Watch instead.
+//
+// The returned channel will be closed if no further notifications can be
+// delivered (for example because the connection was lost) or ctx is done.
+type Notifier interface {
+	Notify(ctx context.Context) (<-chan struct{}, error)
+}
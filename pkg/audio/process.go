@@ -0,0 +1,57 @@
+package audio
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ResolveProcesses fills the process related fields of all sessions of all
+// devices based on their HolderPid. Fields which are already set are kept.
+func (this Devices) ResolveProcesses() {
+	for i := range this {
+		this[i].Sessions.ResolveProcesses()
+	}
+}
+
+// ResolveProcesses fills the process related fields of all sessions based on
+// their HolderPid. Fields which are already set are kept.
+func (this Sessions) ResolveProcesses() {
+	for i := range this {
+		this[i].ResolveProcess()
+	}
+}
+
+// ResolveProcess fills the process related fields based on HolderPid. Fields
+// which are already set are kept. Processes which are gone or which cannot
+// be inspected are silently ignored.
+func (this *Session) ResolveProcess() {
+	if this.HolderPid == 0 {
+		return
+	}
+
+	var p processInfo
+	resolveProcess(this.HolderPid, &p)
+
+	if this.ExecutablePath == "" {
+		this.ExecutablePath = p.executablePath
+	}
+	if this.ProcessName == "" {
+		this.ProcessName = p.name
+	}
+	if this.ProcessName == "" && this.ExecutablePath != "" {
+		this.ProcessName = strings.TrimSuffix(filepath.Base(this.ExecutablePath), filepath.Ext(this.ExecutablePath))
+	}
+	if this.CommandLine == "" {
+		this.CommandLine = p.commandLine
+	}
+	if this.User == "" {
+		this.User = p.user
+	}
+}
+
+type processInfo struct {
+	executablePath string
+	name           string
+	commandLine    string
+	user           string
+}
@@ -0,0 +1,51 @@
+package audio
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+func resolveProcess(pid uint32, target *processInfo) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+
+	if v, err := os.Readlink(dir + "/exe"); err == nil {
+		target.executablePath = v
+		target.name = filepath.Base(v)
+	} else if b, err := os.ReadFile(dir + "/comm"); err == nil {
+		// comm is truncated, so we only use it if we do not know the executable.
+		target.name = strings.TrimSpace(string(b))
+	}
+	if b, err := os.ReadFile(dir + "/cmdline"); err == nil {
+		target.commandLine = strings.TrimSpace(strings.ReplaceAll(string(b), "\x00", " "))
+	}
+	if uid := processUidOf(dir); uid != "" {
+		if u, err := user.LookupId(uid); err == nil {
+			target.user = u.Username
+		} else {
+			target.user = uid
+		}
+	}
+}
+
+func processUidOf(dir string) string {
+	f, err := os.Open(dir + "/status")
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v, ok := strings.CutPrefix(s.Text(), "Uid:"); ok {
+			// Real, effective, saved and filesystem UID; the real one is what we want.
+			if fields := strings.Fields(v); len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,5 @@
+//go:build !linux && !windows
+
+package audio
+
+func resolveProcess(uint32, *processInfo) {}
@@ -0,0 +1,52 @@
+package audio
+
+import (
+	"golang.org/x/sys/windows"
+	"path/filepath"
+	"strings"
+	"unsafe"
+)
+
+func resolveProcess(pid uint32, target *processInfo) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return
+	}
+	defer func() { _ = windows.CloseHandle(h) }()
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size); err == nil {
+		target.executablePath = windows.UTF16ToString(buf[:size])
+		target.name = strings.TrimSuffix(filepath.Base(target.executablePath), filepath.Ext(target.executablePath))
+	}
+
+	target.commandLine = processCommandLineOf(h)
+
+	var token windows.Token
+	if err := windows.OpenProcessToken(h, windows.TOKEN_QUERY, &token); err == nil {
+		defer func() { _ = token.Close() }()
+		if tu, err := token.GetTokenUser(); err == nil {
+			if account, domain, _, err := tu.User.Sid.LookupAccount(""); err == nil {
+				target.user = domain + `\` + account
+			} else {
+				target.user = tu.User.Sid.String()
+			}
+		}
+	}
+}
+
+func processCommandLineOf(h windows.Handle) string {
+	var size uint32
+	// The first call is only used to determine the required size and will fail.
+	_ = windows.NtQueryInformationProcess(h, windows.ProcessCommandLineInformation, nil, 0, &size)
+	if size == 0 {
+		return ""
+	}
+
+	buf := make([]byte, size)
+	if err := windows.NtQueryInformationProcess(h, windows.ProcessCommandLineInformation, unsafe.Pointer(&buf[0]), size, &size); err != nil {
+		return ""
+	}
+	return (*windows.NTUnicodeString)(unsafe.Pointer(&buf[0])).String()
+}
@@ -0,0 +1,234 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"github.com/jfreymuth/pulse/proto"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	pulseClientName = "talk-indicator"
+
+	pulsePropertyApplicationBinary    = "application.process.binary"
+	pulsePropertyApplicationProcessId = "application.process.id"
+	pulsePropertyDeviceDescription    = "device.description"
+)
+
+type Pulse struct {
+	Server  string
+	Timeout time.Duration
+
+	client *proto.Client
+	conn   net.Conn
+	mutex  sync.Mutex
+}
+
+func (this *Pulse) SetupConfiguration(using common.FlagHolder) {
+	using.Flag("audio.pulse.server", "Server string of the PulseAudio (or PipeWire pulse) server to connect to. If empty PULSE_SERVER or the default socket of the current user is used.").
+		Envar("TI_AUDIO_PULSE_SERVER").
+		StringVar(&this.Server)
+	using.Flag("audio.pulse.timeout", "How long to wait for responses of the PulseAudio server.").
+		Envar("TI_AUDIO_PULSE_TIMEOUT").
+		Default("2s").
+		DurationVar(&this.Timeout)
+}
+
+func (this *Pulse) Initialize() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	_, err := this.connection()
+	return err
+}
+
+func (this *Pulse) Dispose() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.disconnect()
+}
+
+func (this *Pulse) FindDevices() (Devices, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	client, err := this.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := this.introspectDevices(client)
+	if err != nil {
+		// The connection might be broken; next time we will start with a new one.
+		_ = this.disconnect()
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (this *Pulse) introspectDevices(client *proto.Client) (result Devices, _ error) {
+	var sources proto.GetSourceInfoListReply
+	if err := client.Request(&proto.GetSourceInfoList{}, &sources); err != nil {
+		return nil, fmt.Errorf("cannot query sources of PulseAudio server: %w", err)
+	}
+
+	var outputs proto.GetSourceOutputInfoListReply
+	if err := client.Request(&proto.GetSourceOutputInfoList{}, &outputs); err != nil {
+		return nil, fmt.Errorf("cannot query source outputs of PulseAudio server: %w", err)
+	}
+
+	for _, source := range sources {
+		// Monitors of sinks are sources, too, but they are not capturing anything of the user.
+		if source.MonitorSourceIndex != proto.Undefined {
+			continue
+		}
+
+		device := Device{
+			Name:  pulsePropertyOr(source.Properties, pulsePropertyDeviceDescription, source.SourceName),
+			Index: source.SourceIndex,
+			Muted: source.Mute,
+		}
+
+		for _, output := range outputs {
+			if output.SourceIndex != source.SourceIndex || output.Corked {
+				continue
+			}
+			device.Sessions = append(device.Sessions, pulseSessionOf(output))
+		}
+
+		result = append(result, device)
+	}
+
+	return
+}
+
+func pulseSessionOf(output *proto.GetSourceOutputInfoReply) Session {
+	s := Session{
+		Muted: output.Muted,
+	}
+	if v, err := strconv.ParseUint(pulsePropertyOr(output.Properties, pulsePropertyApplicationProcessId, ""), 10, 32); err == nil {
+		s.HolderPid = uint32(v)
+	}
+	binary := pulsePropertyOr(output.Properties, pulsePropertyApplicationBinary, "")
+	s.Identifier = fmt.Sprintf("%s|%d", binary, s.HolderPid)
+	return s
+}
+
+func pulsePropertyOr(props proto.PropList, key string, def string) string {
+	if v, ok := props[key]; ok {
+		if str := v.String(); str != "<not a string>" {
+			return str
+		}
+	}
+	return def
+}
+
+func (this *Pulse) connection() (*proto.Client, error) {
+	if this.client != nil {
+		return this.client, nil
+	}
+
+	client, conn, err := this.connect(func(interface{}) {})
+	if err != nil {
+		return nil, err
+	}
+
+	this.client = client
+	this.conn = conn
+	return client, nil
+}
+
+func (this *Pulse) connect(callback func(interface{})) (*proto.Client, net.Conn, error) {
+	client, conn, err := proto.Connect(this.Server)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to PulseAudio server: %w", err)
+	}
+	client.Callback = callback
+	if v := this.Timeout; v > 0 {
+		client.SetTimeout(v)
+	}
+
+	if err := client.Request(&proto.SetClientName{Props: proto.PropList{
+		"application.name": proto.PropListString(pulseClientName),
+	}}, &proto.SetClientNameReply{}); err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("cannot register as client at PulseAudio server: %w", err)
+	}
+
+	return client, conn, nil
+}
+
+// Notify subscribes to changes of sources and source outputs using a
+// dedicated connection, which lives as long as ctx.
+func (this *Pulse) Notify(ctx context.Context) (<-chan struct{}, error) {
+	result := make(chan struct{}, 1)
+	closed := make(chan struct{})
+	var closeOnce sync.Once
+
+	client, conn, err := this.connect(func(msg interface{}) {
+		switch msg.(type) {
+		case *proto.SubscribeEvent:
+			select {
+			case result <- struct{}{}:
+			default:
+				// There is already a pending notification.
+			}
+		case *proto.ConnectionClosed:
+			closeOnce.Do(func() { close(closed) })
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// SubscriptionMaskSourceInput is the mask for source outputs (PA_SUBSCRIPTION_MASK_SOURCE_OUTPUT).
+	if err := client.Request(&proto.Subscribe{Mask: proto.SubscriptionMaskSource | proto.SubscriptionMaskSourceInput}, nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("cannot subscribe to events of PulseAudio server: %w", err)
+	}
+
+	notifications := make(chan struct{})
+	go func() {
+		defer close(notifications)
+		defer func() { _ = conn.Close() }()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-closed:
+				return
+			case <-result:
+				select {
+				case <-ctx.Done():
+					return
+				case notifications <- struct{}{}:
+				}
+			}
+		}
+	}()
+
+	return notifications, nil
+}
+
+func (this *Pulse) disconnect() error {
+	conn := this.conn
+	this.client = nil
+	this.conn = nil
+	if conn == nil {
+		return nil
+	}
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("cannot close connection to PulseAudio server: %w", err)
+	}
+	return nil
+}
+
+func (this *Pulse) GetType() Type {
+	return TypePulse
+}
@@ -0,0 +1,465 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/jfreymuth/pulse/proto"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPulse_FindDevices(t *testing.T) {
+	server := newPulseTestServer(t)
+	instance := server.pulse()
+
+	actual, err := instance.FindDevices()
+	if err != nil {
+		t.Fatalf("FindDevices() failed: %v", err)
+	}
+
+	expected := Devices{{
+		Name:  "Headset Microphone",
+		Index: 1,
+		Sessions: Sessions{
+			{Identifier: "firefox|4711", HolderPid: 4711},
+			{Identifier: "zoom|815", HolderPid: 815, Muted: true},
+			{Identifier: "|0"},
+		},
+	}, {
+		Name:  "alsa_input.pci-0000_00_1f.3.analog-stereo",
+		Index: 3,
+		Muted: true,
+	}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("FindDevices() = %+v; want %+v", actual, expected)
+	}
+}
+
+func TestPulse_FindDevices_reconnectsAfterDisconnect(t *testing.T) {
+	server := newPulseTestServer(t)
+	instance := server.pulse()
+
+	if _, err := instance.FindDevices(); err != nil {
+		t.Fatalf("FindDevices() failed: %v", err)
+	}
+
+	server.disconnectAll()
+
+	if _, err := instance.FindDevices(); err == nil {
+		t.Fatalf("FindDevices() after disconnect should fail")
+	}
+	actual, err := instance.FindDevices()
+	if err != nil {
+		t.Fatalf("FindDevices() after reconnect failed: %v", err)
+	}
+	if len(actual) != 2 {
+		t.Errorf("FindDevices() after reconnect returned %d devices; want 2", len(actual))
+	}
+	if actual := server.authentications(); actual != 2 {
+		t.Errorf("server saw %d authentications; want 2", actual)
+	}
+}
+
+func TestPulse_Notify(t *testing.T) {
+	server := newPulseTestServer(t)
+	instance := server.pulse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notifications, err := instance.Notify(ctx)
+	if err != nil {
+		t.Fatalf("Notify() failed: %v", err)
+	}
+
+	server.emit(proto.SubscribeEvent{Event: proto.EventSinkSourceOutput | proto.EventNew, Index: 7})
+	select {
+	case _, ok := <-notifications:
+		if !ok {
+			t.Fatalf("notifications closed; want notification")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no notification received")
+	}
+
+	server.disconnectAll()
+	expectPulseNotificationsClosed(t, notifications)
+}
+
+func TestPulse_Notify_closesOnCancel(t *testing.T) {
+	server := newPulseTestServer(t)
+	instance := server.pulse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	notifications, err := instance.Notify(ctx)
+	if err != nil {
+		t.Fatalf("Notify() failed: %v", err)
+	}
+
+	cancel()
+	expectPulseNotificationsClosed(t, notifications)
+}
+
+func expectPulseNotificationsClosed(t *testing.T, notifications <-chan struct{}) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-notifications:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("notifications not closed")
+		}
+	}
+}
+
+// pulseTestServer speaks just enough of the native protocol of PulseAudio
+// to serve the requests of Pulse.
+type pulseTestServer struct {
+	t        *testing.T
+	address  string
+	listener net.Listener
+
+	sources proto.GetSourceInfoListReply
+	outputs proto.GetSourceOutputInfoListReply
+
+	mutex       sync.Mutex
+	conns       []*pulseTestConn
+	subscribers []*pulseTestConn
+	auths       int
+}
+
+type pulseTestConn struct {
+	net.Conn
+	mutex sync.Mutex
+}
+
+func newPulseTestServer(t *testing.T) *pulseTestServer {
+	t.Helper()
+
+	dir := t.TempDir()
+	// Without a cookie the client authenticates with an anonymous one.
+	t.Setenv("PULSE_COOKIE", filepath.Join(dir, "cookie"))
+
+	address := filepath.Join(dir, "native")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatalf("cannot listen at %s: %v", address, err)
+	}
+
+	result := &pulseTestServer{
+		t:        t,
+		address:  address,
+		listener: listener,
+		sources: proto.GetSourceInfoListReply{
+			pulseTestSource(0, "alsa_output.pci-0000_00_1f.3.analog-stereo.monitor", 0, false, proto.PropList{
+				pulsePropertyDeviceDescription: proto.PropListString("Monitor of Speakers"),
+			}),
+			pulseTestSource(1, "alsa_input.usb-headset", proto.Undefined, false, proto.PropList{
+				pulsePropertyDeviceDescription: proto.PropListString("Headset Microphone"),
+			}),
+			pulseTestSource(3, "alsa_input.pci-0000_00_1f.3.analog-stereo", proto.Undefined, true, proto.PropList{}),
+		},
+		outputs: proto.GetSourceOutputInfoListReply{
+			pulseTestOutput(10, 1, false, false, "firefox", "4711"),
+			pulseTestOutput(11, 1, false, true, "zoom", "815"),
+			pulseTestOutput(12, 1, true, false, "arecord", "42"),
+			pulseTestOutput(13, 0, false, false, "pavucontrol", "666"),
+			pulseTestOutput(14, 1, false, false, "", ""),
+		},
+	}
+	t.Cleanup(result.close)
+
+	go result.serve()
+	return result
+}
+
+func pulseTestSource(index uint32, name string, monitorOf uint32, muted bool, props proto.PropList) *proto.GetSourceInfoReply {
+	return &proto.GetSourceInfoReply{
+		SourceIndex:        index,
+		SourceName:         name,
+		SampleSpec:         proto.SampleSpec{Format: proto.FormatInt16LE, Channels: 2, Rate: 48000},
+		ChannelMap:         proto.ChannelMap{proto.ChannelLeft, proto.ChannelRight},
+		ModuleIndex:        proto.Undefined,
+		ChannelVolumes:     proto.ChannelVolumes{uint32(proto.VolumeNorm), uint32(proto.VolumeNorm)},
+		Mute:               muted,
+		MonitorSourceIndex: monitorOf,
+		Properties:         props,
+		BaseVolume:         proto.VolumeNorm,
+		CardIndex:          proto.Undefined,
+		Formats:            []proto.FormatInfo{{Encoding: proto.EncodingPCM, Properties: proto.PropList{}}},
+	}
+}
+
+func pulseTestOutput(index, source uint32, corked, muted bool, binary, pid string) *proto.GetSourceOutputInfoReply {
+	props := proto.PropList{}
+	if binary != "" {
+		props[pulsePropertyApplicationBinary] = proto.PropListString(binary)
+	}
+	if pid != "" {
+		props[pulsePropertyApplicationProcessId] = proto.PropListString(pid)
+	}
+	return &proto.GetSourceOutputInfoReply{
+		SourceOutpuIndex: index,
+		MediaName:        "Recording",
+		ModuleIndex:      proto.Undefined,
+		ClientIndex:      index,
+		SourceIndex:      source,
+		SampleSpec:       proto.SampleSpec{Format: proto.FormatFloat32LE, Channels: 1, Rate: 48000},
+		ChannelMap:       proto.ChannelMap{proto.ChannelMono},
+		Properties:       props,
+		Corked:           corked,
+		ChannelVolumes:   proto.ChannelVolumes{uint32(proto.VolumeNorm)},
+		Muted:            muted,
+		FormatInfo:       proto.FormatInfo{Encoding: proto.EncodingPCM, Properties: proto.PropList{}},
+	}
+}
+
+func (this *pulseTestServer) pulse() *Pulse {
+	result := &Pulse{
+		Server:  "unix:" + this.address,
+		Timeout: 2 * time.Second,
+	}
+	this.t.Cleanup(func() { _ = result.Dispose() })
+	return result
+}
+
+func (this *pulseTestServer) serve() {
+	for {
+		conn, err := this.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &pulseTestConn{Conn: conn}
+		this.mutex.Lock()
+		this.conns = append(this.conns, c)
+		this.mutex.Unlock()
+		go this.handle(c)
+	}
+}
+
+func (this *pulseTestServer) handle(conn *pulseTestConn) {
+	defer func() { _ = conn.Close() }()
+
+	header := make([]byte, 20)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		if binary.BigEndian.Uint32(header[4:]) != 0xFFFFFFFF || len(payload) < 10 {
+			continue
+		}
+		op, tag := binary.BigEndian.Uint32(payload[1:]), binary.BigEndian.Uint32(payload[6:])
+
+		var err error
+		switch op {
+		case proto.OpAuth:
+			this.mutex.Lock()
+			this.auths++
+			this.mutex.Unlock()
+			err = conn.reply(tag, &proto.AuthReply{Version: 32})
+		case proto.OpSetClientName:
+			err = conn.reply(tag, &proto.SetClientNameReply{ClientIndex: 1})
+		case proto.OpGetSourceInfoList:
+			values := make([]any, len(this.sources))
+			for i, v := range this.sources {
+				values[i] = v
+			}
+			err = conn.reply(tag, values...)
+		case proto.OpGetSourceOutputInfoList:
+			values := make([]any, len(this.outputs))
+			for i, v := range this.outputs {
+				values[i] = v
+			}
+			err = conn.reply(tag, values...)
+		case proto.OpSubscribe:
+			this.mutex.Lock()
+			this.subscribers = append(this.subscribers, conn)
+			this.mutex.Unlock()
+			err = conn.reply(tag)
+		default:
+			this.t.Errorf("unexpected operation %d", op)
+			return
+		}
+		if err != nil {
+			// The connection was closed by disconnectAll or the client.
+			return
+		}
+	}
+}
+
+func (this *pulseTestServer) emit(event proto.SubscribeEvent) {
+	this.mutex.Lock()
+	subscribers := this.subscribers
+	this.mutex.Unlock()
+
+	for _, conn := range subscribers {
+		if err := conn.send(proto.OpSubscribeEvent, 0xFFFFFFFF, &event); err != nil {
+			this.t.Errorf("cannot emit event: %v", err)
+		}
+	}
+}
+
+func (this *pulseTestServer) authentications() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.auths
+}
+
+// disconnectAll closes all connections like a restarting server would.
+func (this *pulseTestServer) disconnectAll() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, conn := range this.conns {
+		_ = conn.Close()
+	}
+	this.conns = nil
+	this.subscribers = nil
+}
+
+func (this *pulseTestServer) close() {
+	_ = this.listener.Close()
+	this.disconnectAll()
+}
+
+func (this *pulseTestConn) reply(tag uint32, values ...any) error {
+	return this.send(proto.OpReply, tag, values...)
+}
+
+func (this *pulseTestConn) send(op, tag uint32, values ...any) error {
+	var payload bytes.Buffer
+	payload.WriteByte('L')
+	_ = binary.Write(&payload, binary.BigEndian, op)
+	payload.WriteByte('L')
+	_ = binary.Write(&payload, binary.BigEndian, tag)
+	for _, v := range values {
+		if err := pulseTestEncode(&payload, reflect.ValueOf(v).Elem()); err != nil {
+			return err
+		}
+	}
+
+	var frame bytes.Buffer
+	_ = binary.Write(&frame, binary.BigEndian, []uint32{uint32(payload.Len()), 0xFFFFFFFF, 0, 0, 0})
+	frame.Write(payload.Bytes())
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	_, err := this.Write(frame.Bytes())
+	return err
+}
+
+// pulseTestEncode writes all fields of the given struct as tagstruct in the
+// way the ProtocolReader of proto expects them.
+func pulseTestEncode(buf *bytes.Buffer, v reflect.Value) error {
+	u32 := func(u uint32) { _ = binary.Write(buf, binary.BigEndian, u) }
+	u64 := func(u uint64) { _ = binary.Write(buf, binary.BigEndian, u) }
+	propList := func(props proto.PropList) {
+		for key, value := range props {
+			buf.WriteByte('t')
+			buf.WriteString(key)
+			buf.WriteByte(0)
+			buf.WriteByte('L')
+			u32(uint32(len(value)))
+			buf.WriteByte('x')
+			u32(uint32(len(value)))
+			buf.Write(value)
+		}
+		buf.WriteByte('N')
+	}
+	formatInfo := func(f proto.FormatInfo) {
+		buf.WriteByte('f')
+		buf.WriteByte('B')
+		buf.WriteByte(f.Encoding)
+		buf.WriteByte('P')
+		propList(f.Properties)
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch fv := f.Interface().(type) {
+		case string:
+			if fv == "" {
+				buf.WriteByte('N')
+			} else {
+				buf.WriteByte('t')
+				buf.WriteString(fv)
+				buf.WriteByte(0)
+			}
+		case bool:
+			if fv {
+				buf.WriteByte('1')
+			} else {
+				buf.WriteByte('0')
+			}
+		case proto.SampleSpec:
+			buf.WriteByte('a')
+			buf.WriteByte(fv.Format)
+			buf.WriteByte(fv.Channels)
+			u32(fv.Rate)
+		case proto.ChannelMap:
+			buf.WriteByte('m')
+			buf.WriteByte(byte(len(fv)))
+			buf.Write(fv)
+		case proto.ChannelVolumes:
+			buf.WriteByte('v')
+			buf.WriteByte(byte(len(fv)))
+			for _, volume := range fv {
+				u32(volume)
+			}
+		case proto.PropList:
+			buf.WriteByte('P')
+			propList(fv)
+		case proto.Volume:
+			buf.WriteByte('V')
+			u32(uint32(fv))
+		case proto.Microseconds:
+			buf.WriteByte('U')
+			u64(uint64(fv))
+		case proto.FormatInfo:
+			formatInfo(fv)
+		case []proto.FormatInfo:
+			buf.WriteByte('B')
+			buf.WriteByte(byte(len(fv)))
+			for _, format := range fv {
+				formatInfo(format)
+			}
+		default:
+			switch f.Kind() {
+			case reflect.Uint32:
+				buf.WriteByte('L')
+				u32(uint32(f.Uint()))
+			case reflect.Uint8:
+				buf.WriteByte('B')
+				buf.WriteByte(byte(f.Uint()))
+			case reflect.Uint64:
+				buf.WriteByte('R')
+				u64(f.Uint())
+			case reflect.Slice:
+				buf.WriteByte('L')
+				u32(uint32(f.Len()))
+				for j := 0; j < f.Len(); j++ {
+					if err := pulseTestEncode(buf, f.Index(j)); err != nil {
+						return err
+					}
+				}
+			default:
+				return errors.New("cannot encode field " + v.Type().Field(i).Name)
+			}
+		}
+	}
+	return nil
+}
@@ -1,8 +1,28 @@
 package audio
 
+import "slices"
+
 type Session struct {
-	Identifier string `json:"identifier,omitempty"`
-	HolderPid  uint32 `json:"pid,omitempty"`
+	Identifier string `json:"identifier,omitempty" yaml:"identifier,omitempty"`
+	HolderPid  uint32 `json:"pid,omitempty" yaml:"pid,omitempty"`
+
+	// IdentifierParts contains the parts of Identifier - if it could be parsed.
+	IdentifierParts *SessionIdentifier `json:"identifierParts,omitempty" yaml:"identifierParts,omitempty"`
+
+	// ProcessName is the name of the executable of HolderPid - if known.
+	ProcessName string `json:"process,omitempty" yaml:"process,omitempty"`
+	// ExecutablePath is the full path of the executable of HolderPid - if known.
+	ExecutablePath string `json:"path,omitempty" yaml:"path,omitempty"`
+	// CommandLine of HolderPid - if known.
+	CommandLine string `json:"cmdline,omitempty" yaml:"cmdline,omitempty"`
+	// User which runs HolderPid - if known.
+	User string `json:"user,omitempty" yaml:"user,omitempty"`
+
+	// Muted is true if the session itself is muted.
+	Muted bool `json:"muted,omitempty" yaml:"muted,omitempty"`
+	// Peak is the current peak level of the session between 0 and 1 - if the
+	// detector is able to measure it.
+	Peak float32 `json:"peak,omitempty" yaml:"peak,omitempty"`
 }
 
 type Sessions []Session
@@ -15,6 +35,24 @@ func (this Sessions) HasContent() bool {
 	return !this.IsZero()
 }
 
+// Clone returns a deep copy, which can be modified without affecting this
+// instance.
+func (this Sessions) Clone() Sessions {
+	if this == nil {
+		return nil
+	}
+	result := make(Sessions, len(this))
+	for i, v := range this {
+		result[i] = v
+		if parts := v.IdentifierParts; parts != nil {
+			clone := *parts
+			clone.Extra = slices.Clone(parts.Extra)
+			result[i].IdentifierParts = &clone
+		}
+	}
+	return result
+}
+
 func (this Sessions) HasRelevantSession(predicate func(*Session) bool) bool {
 	hasAtLeastOneRelevantSession := false
 	for _, session := range this {
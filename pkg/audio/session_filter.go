@@ -0,0 +1,189 @@
+package audio
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type SessionFilterField uint8
+
+const (
+	SessionFilterFieldProcess    = SessionFilterField(0)
+	SessionFilterFieldPath       = SessionFilterField(1)
+	SessionFilterFieldCmdline    = SessionFilterField(2)
+	SessionFilterFieldUser       = SessionFilterField(3)
+	SessionFilterFieldIdentifier = SessionFilterField(4)
+)
+
+var (
+	AllSessionFilterFields = []SessionFilterField{
+		SessionFilterFieldProcess,
+		SessionFilterFieldPath,
+		SessionFilterFieldCmdline,
+		SessionFilterFieldUser,
+		SessionFilterFieldIdentifier,
+	}
+)
+
+func (this *SessionFilterField) Set(plain string) error {
+	switch strings.TrimSpace(strings.ToLower(plain)) {
+	case "process", "name":
+		*this = SessionFilterFieldProcess
+		return nil
+	case "path", "executable":
+		*this = SessionFilterFieldPath
+		return nil
+	case "cmdline", "commandline":
+		*this = SessionFilterFieldCmdline
+		return nil
+	case "user":
+		*this = SessionFilterFieldUser
+		return nil
+	case "identifier", "id":
+		*this = SessionFilterFieldIdentifier
+		return nil
+	default:
+		return fmt.Errorf("illegal-session-filter-field: %s", plain)
+	}
+}
+
+func (this SessionFilterField) String() string {
+	switch this {
+	case SessionFilterFieldProcess:
+		return "process"
+	case SessionFilterFieldPath:
+		return "path"
+	case SessionFilterFieldCmdline:
+		return "cmdline"
+	case SessionFilterFieldUser:
+		return "user"
+	case SessionFilterFieldIdentifier:
+		return "identifier"
+	default:
+		return fmt.Sprintf("illegal-session-filter-field-%d", this)
+	}
+}
+
+// valuesOf returns all values of the given session which are compared
+// against the patterns of this field.
+func (this SessionFilterField) valuesOf(s *Session) []string {
+	switch this {
+	case SessionFilterFieldProcess:
+		result := []string{s.ProcessName}
+		if s.ExecutablePath != "" {
+			result = append(result, filepath.Base(s.ExecutablePath))
+		}
+		return result
+	case SessionFilterFieldPath:
+		return []string{s.ExecutablePath}
+	case SessionFilterFieldCmdline:
+		return []string{s.CommandLine}
+	case SessionFilterFieldUser:
+		result := []string{s.User}
+		if i := strings.LastIndexByte(s.User, '\\'); i >= 0 {
+			result = append(result, s.User[i+1:])
+		}
+		return result
+	case SessionFilterFieldIdentifier:
+		return []string{s.Identifier}
+	default:
+		return nil
+	}
+}
+
+// SessionFilter matches sessions where Field matches at least one of the
+// Values. Values are compared case-insensitive and might contain * as
+// wildcard. Format: <field>=<value>[,<value>...]
+type SessionFilter struct {
+	Field  SessionFilterField
+	Values []string
+
+	patterns []*regexp.Regexp
+}
+
+func (this *SessionFilter) Set(plain string) error {
+	plainField, plainValues, ok := strings.Cut(plain, "=")
+	if !ok {
+		return fmt.Errorf("illegal-session-filter: %s", plain)
+	}
+
+	var result SessionFilter
+	if err := result.Field.Set(plainField); err != nil {
+		return err
+	}
+	for _, v := range strings.Split(plainValues, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		pattern, err := regexp.Compile("(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(v), `\*`, ".*") + "$")
+		if err != nil {
+			return fmt.Errorf("illegal-session-filter: %s: %w", plain, err)
+		}
+		result.Values = append(result.Values, v)
+		result.patterns = append(result.patterns, pattern)
+	}
+	if len(result.Values) == 0 {
+		return fmt.Errorf("illegal-session-filter: %s", plain)
+	}
+
+	*this = result
+	return nil
+}
+
+func (this SessionFilter) String() string {
+	return this.Field.String() + "=" + strings.Join(this.Values, ",")
+}
+
+func (this SessionFilter) Matches(s *Session) bool {
+	for _, v := range this.Field.valuesOf(s) {
+		if v == "" {
+			continue
+		}
+		for _, pattern := range this.patterns {
+			if pattern.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type SessionFilters []SessionFilter
+
+func (this *SessionFilters) Set(plain string) error {
+	var v SessionFilter
+	if err := v.Set(plain); err != nil {
+		return err
+	}
+	*this = append(*this, v)
+	return nil
+}
+
+func (this SessionFilters) Strings() []string {
+	result := make([]string, len(this))
+	for i, v := range this {
+		result[i] = v.String()
+	}
+	return result
+}
+
+func (this SessionFilters) String() string {
+	return strings.Join(this.Strings(), " ")
+}
+
+func (this SessionFilters) IsCumulative() bool {
+	return true
+}
+
+// MatchingFilter returns the first filter which matches the given session.
+func (this SessionFilters) MatchingFilter(s *Session) (SessionFilter, bool) {
+	for _, candidate := range this {
+		if candidate.Matches(s) {
+			return candidate, true
+		}
+	}
+	return SessionFilter{}, false
+}
@@ -0,0 +1,92 @@
+package audio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SessionIdentifier contains the parts of an identifier of a WASAPI session,
+// like: {0.0.1.00000000}.{<endpoint guid>}|\Device\HarddiskVolume3\Program Files\App\app.exe%b{<instance guid>}
+type SessionIdentifier struct {
+	// EndpointId is the ID of the audio endpoint (the device) the session belongs to.
+	EndpointId string `json:"endpointId" yaml:"endpointId"`
+	// ExecutablePath is the path of the executable as NT device path, or # for system sessions.
+	ExecutablePath string `json:"executablePath,omitempty" yaml:"executablePath,omitempty"`
+	// Flags are the characters between % and the instance GUID.
+	Flags string `json:"flags,omitempty" yaml:"flags,omitempty"`
+	// InstanceGuid is the GUID (including braces) of the session instance.
+	InstanceGuid string `json:"instanceGuid,omitempty" yaml:"instanceGuid,omitempty"`
+	// Extra contains further |-separated parts which are present in session
+	// instance identifiers.
+	Extra []string `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+// ParseSessionIdentifier splits the given identifier of a WASAPI session into
+// its parts. It fails if plain does not follow this structure.
+func ParseSessionIdentifier(plain string) (SessionIdentifier, error) {
+	endpointId, rest, ok := strings.Cut(plain, "|")
+	if !ok || endpointId == "" || rest == "" {
+		return SessionIdentifier{}, fmt.Errorf("illegal-session-identifier: %s", plain)
+	}
+
+	parts := strings.Split(rest, "|")
+	application := parts[0]
+
+	i := strings.LastIndexByte(application, '%')
+	if i < 0 {
+		return SessionIdentifier{}, fmt.Errorf("illegal-session-identifier: %s", plain)
+	}
+	result := SessionIdentifier{
+		EndpointId:     endpointId,
+		ExecutablePath: application[:i],
+	}
+	if len(parts) > 1 {
+		result.Extra = parts[1:]
+	}
+
+	instance := application[i+1:]
+	j := strings.IndexByte(instance, '{')
+	if j < 0 || !strings.HasSuffix(instance, "}") {
+		return SessionIdentifier{}, fmt.Errorf("illegal-session-identifier: %s", plain)
+	}
+	result.Flags = instance[:j]
+	result.InstanceGuid = instance[j:]
+
+	return result, nil
+}
+
+// ParseIdentifiers sets IdentifierParts of all sessions of all devices whose
+// Identifier can be parsed using ParseSessionIdentifier.
+func (this Devices) ParseIdentifiers() {
+	for i := range this {
+		this[i].Sessions.ParseIdentifiers()
+	}
+}
+
+// ParseIdentifiers sets IdentifierParts of all sessions whose Identifier can
+// be parsed using ParseSessionIdentifier.
+func (this Sessions) ParseIdentifiers() {
+	for i, s := range this {
+		if v, err := ParseSessionIdentifier(s.Identifier); err == nil {
+			this[i].IdentifierParts = &v
+		}
+	}
+}
+
+func (this SessionIdentifier) IsZero() bool {
+	return this.EndpointId == ""
+}
+
+// IsSystem reports if this identifies a session of the system itself instead
+// of a specific executable.
+func (this SessionIdentifier) IsSystem() bool {
+	return this.ExecutablePath == "#"
+}
+
+func (this SessionIdentifier) String() string {
+	result := this.EndpointId + "|" + this.ExecutablePath + "%" + this.Flags + this.InstanceGuid
+	for _, v := range this.Extra {
+		result += "|" + v
+	}
+	return result
+}
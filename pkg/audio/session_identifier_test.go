@@ -0,0 +1,109 @@
+package audio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSessionIdentifier(t *testing.T) {
+	const endpoint = "{0.0.1.00000000}.{8b5c6f2a-52c4-4c5d-9e8f-0a1b2c3d4e5f}"
+
+	cases := []struct {
+		name     string
+		plain    string
+		expected SessionIdentifier
+		system   bool
+	}{{
+		name:  "application",
+		plain: endpoint + `|\Device\HarddiskVolume3\Program Files\Mozilla Firefox\firefox.exe%b{00000000-0000-0000-0000-000000000000}`,
+		expected: SessionIdentifier{
+			EndpointId:     endpoint,
+			ExecutablePath: `\Device\HarddiskVolume3\Program Files\Mozilla Firefox\firefox.exe`,
+			Flags:          "b",
+			InstanceGuid:   "{00000000-0000-0000-0000-000000000000}",
+		},
+	}, {
+		name:  "system sounds",
+		plain: "{0.0.0.00000000}.{3e6d1c5a-7f2b-4e8a-9c1d-2b3a4c5d6e7f}|#%b{A9EF3FD9-4240-455E-A4D5-F2B3301887B2}",
+		expected: SessionIdentifier{
+			EndpointId:     "{0.0.0.00000000}.{3e6d1c5a-7f2b-4e8a-9c1d-2b3a4c5d6e7f}",
+			ExecutablePath: "#",
+			Flags:          "b",
+			InstanceGuid:   "{A9EF3FD9-4240-455E-A4D5-F2B3301887B2}",
+		},
+		system: true,
+	}, {
+		name:  "UWP package",
+		plain: endpoint + `|\Device\HarddiskVolume3\Program Files\WindowsApps\Microsoft.SkypeApp_15.88.3401.0_x86__kzf8qxf38zg5c\Skype\Skype.exe%b{00000000-0000-0000-0000-000000000000}`,
+		expected: SessionIdentifier{
+			EndpointId:     endpoint,
+			ExecutablePath: `\Device\HarddiskVolume3\Program Files\WindowsApps\Microsoft.SkypeApp_15.88.3401.0_x86__kzf8qxf38zg5c\Skype\Skype.exe`,
+			Flags:          "b",
+			InstanceGuid:   "{00000000-0000-0000-0000-000000000000}",
+		},
+	}, {
+		name:  "session instance",
+		plain: endpoint + `|\Device\HarddiskVolume3\Windows\System32\svchost.exe%b{00000000-0000-0000-0000-000000000000}|1%b12840`,
+		expected: SessionIdentifier{
+			EndpointId:     endpoint,
+			ExecutablePath: `\Device\HarddiskVolume3\Windows\System32\svchost.exe`,
+			Flags:          "b",
+			InstanceGuid:   "{00000000-0000-0000-0000-000000000000}",
+			Extra:          []string{"1%b12840"},
+		},
+	}, {
+		name:  "percent in path",
+		plain: endpoint + `|\Device\HarddiskVolume3\Users\me\100% Tools\recorder.exe%b{00000000-0000-0000-0000-000000000000}`,
+		expected: SessionIdentifier{
+			EndpointId:     endpoint,
+			ExecutablePath: `\Device\HarddiskVolume3\Users\me\100% Tools\recorder.exe`,
+			Flags:          "b",
+			InstanceGuid:   "{00000000-0000-0000-0000-000000000000}",
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := ParseSessionIdentifier(c.plain)
+			if err != nil {
+				t.Fatalf("ParseSessionIdentifier() failed: %v", err)
+			}
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("ParseSessionIdentifier() = %+v; want %+v", actual, c.expected)
+			}
+			if actual.IsSystem() != c.system {
+				t.Errorf("IsSystem() = %v; want %v", actual.IsSystem(), c.system)
+			}
+			if actual.String() != c.plain {
+				t.Errorf("String() = %s; want %s", actual.String(), c.plain)
+			}
+		})
+	}
+}
+
+func TestParseSessionIdentifier_rejects(t *testing.T) {
+	cases := []struct {
+		name  string
+		plain string
+	}{
+		{"empty", ""},
+		{"pulse", "firefox|4711"},
+		{"pulse without binary", "|0"},
+		{"alsa", "hw:0,0,0"},
+		{"alsa with executable", "hw:1,0,0|/usr/bin/arecord"},
+		{"video", "/dev/video0|/usr/lib/firefox/firefox"},
+		{"missing application", "{0.0.1.00000000}.{8b5c6f2a-52c4-4c5d-9e8f-0a1b2c3d4e5f}|"},
+		{"missing endpoint", `|\Device\HarddiskVolume3\app.exe%b{00000000-0000-0000-0000-000000000000}`},
+		{"missing percent", `{0.0.1.00000000}.{8b5c6f2a-52c4-4c5d-9e8f-0a1b2c3d4e5f}|\Device\HarddiskVolume3\app.exe`},
+		{"missing instance", `{0.0.1.00000000}.{8b5c6f2a-52c4-4c5d-9e8f-0a1b2c3d4e5f}|\Device\HarddiskVolume3\app.exe%b`},
+		{"unterminated instance", `{0.0.1.00000000}.{8b5c6f2a-52c4-4c5d-9e8f-0a1b2c3d4e5f}|\Device\HarddiskVolume3\app.exe%b{00000000-0000`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual, err := ParseSessionIdentifier(c.plain); err == nil {
+				t.Errorf("ParseSessionIdentifier(%q) = %+v; want error", c.plain, actual)
+			}
+		})
+	}
+}
@@ -3,13 +3,15 @@ package audio
 import (
 	"fmt"
 	"github.com/blaubaer/talk-indicator/pkg/common"
+	log "github.com/echocat/slf4g"
 	"github.com/go-ole/go-ole"
 	"github.com/moutend/go-wca/pkg/wca"
 	"golang.org/x/sys/windows"
+	"time"
 	"unsafe"
 )
 
-func (this Device) getSessionsOfDevice(sessionManager *wca.IAudioSessionManager2) (result Sessions, _ error) {
+func (this Device) getSessionsOfDevice(sessionManager *wca.IAudioSessionManager2, meters *sessionPeakMeters) (result Sessions, _ error) {
 	var enumerator *wca.IAudioSessionEnumerator
 	if err := sessionManager.GetSessionEnumerator(&enumerator); err != nil {
 		return nil, fmt.Errorf("cannot get audio sessions of device %v: %w", this, err)
@@ -22,60 +24,165 @@ func (this Device) getSessionsOfDevice(sessionManager *wca.IAudioSessionManager2
 	}
 
 	for i := 0; i < count; i++ {
-		session, ok, err := this.introspectSessionOf(enumerator, i)
+		session, meter, ok, err := this.introspectSessionOf(enumerator, i)
 		if err != nil {
 			return nil, err
 		}
 		if ok {
+			meters.add(this, len(result), meter)
 			result = append(result, session)
 		}
 	}
 	return
 }
 
-func (this Device) introspectSessionOf(sessions *wca.IAudioSessionEnumerator, sessionIndex int) (Session, bool, error) {
+func (this Device) introspectSessionOf(sessions *wca.IAudioSessionEnumerator, sessionIndex int) (Session, *wca.IAudioMeterInformation, bool, error) {
 	var sessionControl *wca.IAudioSessionControl
 	if err := sessions.GetSession(sessionIndex, &sessionControl); err != nil {
-		return Session{}, false, fmt.Errorf("cannot get audio session %d of device %v: %w", sessionIndex, this, err)
+		return Session{}, nil, false, fmt.Errorf("cannot get audio session %d of device %v: %w", sessionIndex, this, err)
 	}
 	defer sessionControl.Release()
 
 	return this.introspectSession(sessionControl, sessionIndex)
 }
 
-func (this Device) introspectSession(sessionControl *wca.IAudioSessionControl, sessionIndex int) (Session, bool, error) {
+// introspectSession returns the session if it is active. Its meter has to be
+// released by the caller if it is not nil.
+func (this Device) introspectSession(sessionControl *wca.IAudioSessionControl, sessionIndex int) (Session, *wca.IAudioMeterInformation, bool, error) {
 	dispatch, err := sessionControl.QueryInterface(wca.IID_IAudioSessionControl2)
 	if err != nil {
-		return Session{}, false, fmt.Errorf("cannot get audio session control %d of device %v: %w", sessionIndex, this, err)
+		return Session{}, nil, false, fmt.Errorf("cannot get audio session control %d of device %v: %w", sessionIndex, this, err)
 	}
 	sessionControl2 := (*wca.IAudioSessionControl2)(unsafe.Pointer(dispatch))
 	defer sessionControl2.Release()
 
 	if err := sessionControl2.IsSystemSoundsSession(); err == nil {
-		return Session{}, false, nil
+		return Session{}, nil, false, nil
 	} else if oe, ok := common.AsError[*ole.OleError](err); ok && oe.Code() == uintptr(windows.ERROR_INVALID_FUNCTION) {
 		// Ok, continue....
 	} else {
-		return Session{}, false, fmt.Errorf("cannot get determine if audio session %d of device %v is a system session or not: %w", sessionIndex, this, err)
+		return Session{}, nil, false, fmt.Errorf("cannot get determine if audio session %d of device %v is a system session or not: %w", sessionIndex, this, err)
 	}
 
 	var state uint32
 	if err := sessionControl.GetState(&state); err != nil {
-		return Session{}, false, fmt.Errorf("cannot get state of audio session %d of device %v: %w", sessionIndex, this, err)
+		return Session{}, nil, false, fmt.Errorf("cannot get state of audio session %d of device %v: %w", sessionIndex, this, err)
 	}
 
 	switch state {
 	case 1:
 		var s Session
 		if err := sessionControl2.GetProcessId(&s.HolderPid); err != nil {
-			return Session{}, false, fmt.Errorf("cannot get PID of processes which hold session %d of device %v: %w", sessionIndex, this, err)
+			return Session{}, nil, false, fmt.Errorf("cannot get PID of processes which hold session %d of device %v: %w", sessionIndex, this, err)
 		}
 		if err := sessionControl2.GetSessionIdentifier(&s.Identifier); err != nil {
-			return Session{}, false, fmt.Errorf("cannot get session identifier of audio session %d of device %v: %w", sessionIndex, this, err)
+			return Session{}, nil, false, fmt.Errorf("cannot get session identifier of audio session %d of device %v: %w", sessionIndex, this, err)
 		}
+		this.introspectSessionMute(sessionControl2, &s)
 
-		return s, true, nil
+		return s, this.sessionMeterOf(sessionControl2, &s), true, nil
 	default:
-		return Session{}, false, nil
+		return Session{}, nil, false, nil
+	}
+}
+
+// introspectSessionMute sets the mute state of the given session. If it cannot
+// be determined the session is treated as not muted instead of failing all
+// devices.
+func (this Device) introspectSessionMute(sessionControl2 *wca.IAudioSessionControl2, s *Session) {
+	volumeDispatch, err := sessionControl2.QueryInterface(wca.IID_ISimpleAudioVolume)
+	if err != nil {
+		log.WithError(err).
+			With("device", this).
+			With("session", s.Identifier).
+			Warn("Cannot get volume of audio session. Treating it as not muted.")
+		return
+	}
+	volume := (*wca.ISimpleAudioVolume)(unsafe.Pointer(volumeDispatch))
+	defer volume.Release()
+
+	if err := volume.GetMute(&s.Muted); err != nil {
+		log.WithError(err).
+			With("device", this).
+			With("session", s.Identifier).
+			Warn("Cannot get mute state of audio session. Treating it as not muted.")
+		s.Muted = false
+	}
+}
+
+// sessionMeterOf returns the meter of the given session or nil if it is not
+// available; in this case the session just has no peak level.
+func (this Device) sessionMeterOf(sessionControl2 *wca.IAudioSessionControl2, s *Session) *wca.IAudioMeterInformation {
+	meterDispatch, err := sessionControl2.QueryInterface(wca.IID_IAudioMeterInformation)
+	if err != nil {
+		log.WithError(err).
+			With("device", this).
+			With("session", s.Identifier).
+			Warn("Cannot get meter of audio session. Ignoring its peak level.")
+		return nil
+	}
+	return (*wca.IAudioMeterInformation)(unsafe.Pointer(meterDispatch))
+}
+
+// sessionPeakMeters holds the meters of all found sessions, so their peak
+// levels can be sampled over a window instead of only once. A single sample
+// only covers a few milliseconds, which would let speaking flap between
+// words.
+type sessionPeakMeters []sessionPeakMeter
+
+type sessionPeakMeter struct {
+	device  int
+	session int
+	meter   *wca.IAudioMeterInformation
+}
+
+func (this *sessionPeakMeters) add(device Device, session int, meter *wca.IAudioMeterInformation) {
+	if meter == nil {
+		return
+	}
+	// Devices are collected in the order of their index.
+	*this = append(*this, sessionPeakMeter{int(device.Index), session, meter})
+}
+
+// sample sets the highest peak level measured within window at each session
+// of devices, sampled every interval.
+func (this sessionPeakMeters) sample(devices Devices, window, interval time.Duration) {
+	if len(this) == 0 {
+		return
+	}
+	deadline := time.Now().Add(window)
+	this.sampleOnce(devices)
+	for interval > 0 && time.Now().Add(interval).Before(deadline) {
+		time.Sleep(interval)
+		this.sampleOnce(devices)
+	}
+}
+
+func (this sessionPeakMeters) sampleOnce(devices Devices) {
+	for i, m := range this {
+		if m.meter == nil {
+			continue
+		}
+		device := devices[m.device]
+		s := &device.Sessions[m.session]
+		var peak float32
+		if err := m.meter.GetPeakValue(&peak); err != nil {
+			log.WithError(err).
+				With("device", device).
+				With("session", s.Identifier).
+				Warn("Cannot get peak value of audio session. Ignoring its peak level.")
+			m.meter.Release()
+			this[i].meter = nil
+			continue
+		}
+		s.Peak = max(s.Peak, peak)
+	}
+}
+
+func (this sessionPeakMeters) release() {
+	for _, m := range this {
+		if m.meter != nil {
+			m.meter.Release()
+		}
 	}
 }
@@ -1,19 +1,182 @@
 package audio
 
-import "github.com/blaubaer/talk-indicator/pkg/common"
+import (
+	"context"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"github.com/blaubaer/talk-indicator/pkg/metrics"
+	log "github.com/echocat/slf4g"
+	"sync"
+	"time"
+)
 
-type Stack struct{}
+type Stack struct {
+	Detector
 
-func (this *Stack) SetupConfiguration(_ common.FlagHolder) {}
+	PollInterval time.Duration
+
+	initialized sync.Once
+	typeFacade  stackTypeFacade
+	findMutex   sync.Mutex
+}
+
+func (this *Stack) SetupConfiguration(using common.FlagHolder) {
+	this.ensure()
+	this.typeFacade.SetupConfiguration(using)
+
+	using.Flag("audio.pollInterval", "How often devices are polled if the selected audio type cannot notify about changes on its own.").
+		Envar("TI_AUDIO_POLL_INTERVAL").
+		Default(this.PollInterval.String()).
+		DurationVar(&this.PollInterval)
+}
 
 func (this *Stack) Initialize() error {
-	return nil
+	this.ensure()
+	return this.Detector.Initialize()
 }
 
 func (this *Stack) Dispose() error {
-	return nil
+	this.ensure()
+	return this.Detector.Dispose()
 }
 
 func (this *Stack) FindDevices() (Devices, error) {
-	return findDevices()
+	this.ensure()
+
+	this.findMutex.Lock()
+	defer this.findMutex.Unlock()
+
+	defer metrics.Observe(metrics.FindDevicesDuration.WithLabelValues("audio", this.Detector.GetType().String()), time.Now())
+	result, err := this.Detector.FindDevices()
+	if err != nil {
+		return nil, err
+	}
+	result.ParseIdentifiers()
+	result.ResolveProcesses()
+	return result, nil
+}
+
+// Watch emits the current devices immediately and afterwards every time the
+// selected Detector reports a change. If it is not a Notifier (or the
+// notifications are failing) the devices are polled every PollInterval
+// instead. Failures while finding the devices are logged and skipped. The
+// returned channel is closed as soon as ctx is done.
+func (this *Stack) Watch(ctx context.Context) <-chan Devices {
+	this.ensure()
+
+	result := make(chan Devices)
+	go func() {
+		defer close(result)
+
+		var notifications <-chan struct{}
+		notificationsFailed := false
+		for {
+			if notifications == nil {
+				notifications = this.notifications(ctx, notificationsFailed)
+				notificationsFailed = notifications == nil
+			}
+
+			if devices, err := this.FindDevices(); err != nil {
+				log.WithError(err).
+					Error("Cannot find audio devices.")
+			} else {
+				select {
+				case <-ctx.Done():
+					return
+				case result <- devices:
+				}
+			}
+
+			var poll <-chan time.Time
+			if notifications == nil {
+				poll = time.After(this.PollInterval)
+			}
+
+			select {
+			case <-ctx.Done():
+				log.Debug("Audio watch interrupted.")
+				return
+			case _, ok := <-notifications:
+				if !ok {
+					log.Warn("Notifications of audio devices stopped. Falling back to polling until they can be restored.")
+					notifications = nil
+				}
+			case <-poll:
+			}
+		}
+	}()
+
+	return result
+}
+
+func (this *Stack) notifications(ctx context.Context, failedBefore bool) <-chan struct{} {
+	notifier, ok := this.Detector.(Notifier)
+	if !ok {
+		return nil
+	}
+	result, err := notifier.Notify(ctx)
+	if err != nil {
+		l := log.WithError(err).
+			With("interval", this.PollInterval)
+		if failedBefore {
+			l.Debug("Still cannot receive notifications of audio devices. Continue polling.")
+		} else {
+			l.Warn("Cannot receive notifications of audio devices. Falling back to polling.")
+		}
+		return nil
+	}
+	if failedBefore {
+		log.Info("Notifications of audio devices restored.")
+	}
+	return result
+}
+
+func (this *Stack) GetType() Type {
+	this.ensure()
+	return this.Detector.GetType()
+}
+
+func (this *Stack) ensure() {
+	this.initialized.Do(func() {
+		this.PollInterval = defaultPollInterval
+		this.typeFacade.owner = this
+		this.typeFacade.allVariants = make(map[Type]Detector, len(AllTypes))
+		for _, t := range AllTypes {
+			this.typeFacade.allVariants[t] = t.newInstance()
+		}
+		this.Detector = this.typeFacade.allVariants[TypeDefault]
+	})
+}
+
+type stackTypeFacade struct {
+	owner       *Stack
+	allVariants map[Type]Detector
+}
+
+func (this *stackTypeFacade) Set(plain string) error {
+	var t Type
+	if err := t.Set(plain); err != nil {
+		return err
+	}
+	d, ok := this.allVariants[t]
+	if !ok {
+		return fmt.Errorf("illegal-audio-type: %s", plain)
+	}
+	this.owner.Detector = d
+	return nil
+}
+
+func (this *stackTypeFacade) String() string {
+	return this.owner.Detector.GetType().String()
+}
+
+func (this *stackTypeFacade) SetupConfiguration(using common.FlagHolder) {
+	using.Flag("audio.type", fmt.Sprintf("Type how the audio sessions should be detected. Possible values: %v", AllTypes)).
+		Default(TypeDefault.String()).
+		Envar("TI_AUDIO_TYPE").
+		SetValue(this)
+
+	for _, d := range this.allVariants {
+		d.SetupConfiguration(using)
+	}
 }
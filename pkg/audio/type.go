@@ -0,0 +1,87 @@
+package audio
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Type uint8
+
+const (
+	TypeWasapi = Type(0)
+	TypeAlsa   = Type(1)
+	TypePulse  = Type(2)
+	TypeFake   = Type(3)
+)
+
+var (
+	AllTypes = Types{
+		TypeWasapi,
+		TypeAlsa,
+		TypePulse,
+		TypeFake,
+	}
+)
+
+func (this *Type) Set(plain string) error {
+	switch strings.TrimSpace(strings.ToLower(plain)) {
+	case "wasapi":
+		*this = TypeWasapi
+		return nil
+	case "alsa":
+		*this = TypeAlsa
+		return nil
+	case "pulse", "pulseaudio", "pipewire":
+		*this = TypePulse
+		return nil
+	case "fake":
+		*this = TypeFake
+		return nil
+	default:
+		return fmt.Errorf("illegal-audio-type: %s", plain)
+	}
+}
+
+func (this Type) String() string {
+	switch this {
+	case TypeWasapi:
+		return "wasapi"
+	case TypeAlsa:
+		return "alsa"
+	case TypePulse:
+		return "pulse"
+	case TypeFake:
+		return "fake"
+	default:
+		return fmt.Sprintf("illegal-audio-type-%d", this)
+	}
+}
+
+func (this Type) newInstance() Detector {
+	switch this {
+	case TypeWasapi:
+		return &Wasapi{}
+	case TypeAlsa:
+		return &Alsa{}
+	case TypePulse:
+		return &Pulse{}
+	case TypeFake:
+		return &Fake{}
+	default:
+		panic(fmt.Errorf("illegal-audio-type-%d", this))
+	}
+}
+
+type Types []Type
+
+func (this Types) Strings() []string {
+	result := make([]string, len(this))
+	for i, v := range this {
+		result[i] = v.String()
+	}
+	return result
+}
+
+func (this Types) String() string {
+	return strings.Join(this.Strings(), ",")
+}
@@ -0,0 +1,7 @@
+package audio
+
+import "time"
+
+const TypeDefault = TypeAlsa
+
+const defaultPollInterval = 2 * time.Second
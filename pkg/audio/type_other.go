@@ -0,0 +1,9 @@
+//go:build !windows && !linux
+
+package audio
+
+import "time"
+
+const TypeDefault = TypePulse
+
+const defaultPollInterval = 2 * time.Second
@@ -0,0 +1,10 @@
+package audio
+
+import "time"
+
+const TypeDefault = TypeWasapi
+
+// defaultPollInterval is not lower than the check interval which was used
+// before devices were watched, because Wasapi cannot notify about changes and
+// each poll enumerates all devices and sessions via COM.
+const defaultPollInterval = 5 * time.Second
@@ -0,0 +1,38 @@
+package audio
+
+import (
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"time"
+)
+
+type Wasapi struct {
+	PeakWindow   time.Duration
+	PeakInterval time.Duration
+}
+
+func (this *Wasapi) SetupConfiguration(using common.FlagHolder) {
+	using.Flag("audio.wasapi.peakWindow", "How long the peak level of each session is sampled on every poll. The highest level within this window is used to detect speaking. 0 samples only once.").
+		Envar("TI_AUDIO_WASAPI_PEAK_WINDOW").
+		Default("500ms").
+		DurationVar(&this.PeakWindow)
+	using.Flag("audio.wasapi.peakInterval", "How often the peak level of each session is sampled within audio.wasapi.peakWindow.").
+		Envar("TI_AUDIO_WASAPI_PEAK_INTERVAL").
+		Default("20ms").
+		DurationVar(&this.PeakInterval)
+}
+
+func (this *Wasapi) Initialize() error {
+	return nil
+}
+
+func (this *Wasapi) Dispose() error {
+	return nil
+}
+
+func (this *Wasapi) FindDevices() (Devices, error) {
+	return findWasapiDevices(this.PeakWindow, this.PeakInterval)
+}
+
+func (this *Wasapi) GetType() Type {
+	return TypeWasapi
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package audio
+
+import (
+	"fmt"
+	"time"
+)
+
+func findWasapiDevices(time.Duration, time.Duration) (Devices, error) {
+	return nil, fmt.Errorf("audio type %v is only supported on Windows", TypeWasapi)
+}
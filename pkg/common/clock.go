@@ -0,0 +1,25 @@
+package common
+
+import "time"
+
+// Clock provides the current time and lets callers wait for a point in time.
+// Everything which replays something over time should use it, so it can be
+// driven step by step; for example in tests.
+type Clock interface {
+	Now() time.Time
+	// At returns a channel which receives the time once t is reached.
+	At(t time.Time) <-chan time.Time
+}
+
+// SystemClock is the Clock of the system itself.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (this systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (this systemClock) At(t time.Time) <-chan time.Time {
+	return time.After(time.Until(t))
+}
@@ -1,7 +1,31 @@
 package common
 
-import "github.com/alecthomas/kingpin/v2"
+import (
+	"github.com/alecthomas/kingpin/v2"
+	"sync"
+)
 
 type FlagHolder interface {
 	Flag(name, help string) *kingpin.FlagClause
 }
+
+var (
+	secretFlags      = map[string]bool{}
+	secretFlagsMutex sync.RWMutex
+)
+
+// Secret marks the given flag as holding a secret, like a password or a
+// token, whose value must never be printed.
+func Secret(flag *kingpin.FlagClause) *kingpin.FlagClause {
+	secretFlagsMutex.Lock()
+	defer secretFlagsMutex.Unlock()
+	secretFlags[flag.Model().Name] = true
+	return flag
+}
+
+// IsSecret reports if the flag of the given name was marked using Secret.
+func IsSecret(name string) bool {
+	secretFlagsMutex.RLock()
+	defer secretFlagsMutex.RUnlock()
+	return secretFlags[name]
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"fmt"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config loads a structured (YAML or JSON) file and uses its values as the
+// defaults of the flags of an application. Flags given at the command line
+// and environment variables still take precedence over the file.
+//
+// The keys of the file are the names of the flags, where each . of a flag
+// name might also be expressed as nesting:
+//
+//	audio:
+//	  type: pulse
+//	signal:
+//	  type: [hue, record]
+//	  hue:
+//	    muted:
+//	      hue: 0
+//	  webhook.header:
+//	    Authorization: Bearer foo
+type Config struct {
+	File          string
+	WatchInterval time.Duration
+}
+
+// SetupConfiguration registers the config flag and the config command
+// (including its dump sub command) at the given application.
+func (this *Config) SetupConfiguration(app *kingpin.Application) {
+	app.Flag("config", "YAML or JSON file which provides the defaults of all other flags. Flags and environment variables take precedence.").
+		Envar("TI_CONFIG").
+		StringVar(&this.File)
+	app.Flag("config.watchInterval", "How often the configuration file is checked for changes, which are reloaded while running. 0 disables the check; SIGHUP always triggers a reload.").
+		Envar("TI_CONFIG_WATCH_INTERVAL").
+		Default("2s").
+		DurationVar(&this.WatchInterval)
+
+	cmd := app.Command("config", "Work with the configuration.")
+	cmd.Command("dump", "Prints the effective configuration as YAML, merged from the configuration file, environment variables and flags.").
+		Action(func(*kingpin.ParseContext) error {
+			return this.Dump(app, os.Stdout)
+		})
+}
+
+// Prepare determines the configuration file from the given arguments (or the
+// environment) and applies its values as defaults to all flags of the given
+// application. It has to be called before the application parses args.
+func (this *Config) Prepare(app *kingpin.Application, args []string) error {
+	file, err := this.resolveFile(app, args)
+	if err != nil || file == "" {
+		return err
+	}
+
+	values, err := Load(file)
+	if err != nil {
+		return err
+	}
+
+	return Apply(app, values)
+}
+
+func (this *Config) resolveFile(app *kingpin.Application, args []string) (string, error) {
+	ctx, err := app.ParseContext(args)
+	if ctx == nil {
+		return "", err
+	}
+	// Every other problem of the arguments is reported later by Parse().
+	for _, element := range ctx.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok && flag.Model().Name == "config" && element.Value != nil {
+			return *element.Value, nil
+		}
+	}
+	return os.Getenv("TI_CONFIG"), nil
+}
+
+// Values are the flattened values of a configuration file by the names of
+// their flags.
+type Values map[string][]string
+
+// Load reads the given file and flattens its content into Values.
+func Load(file string) (Values, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read configuration from %s: %w", file, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, fmt.Errorf("cannot parse configuration of %s: %w", file, err)
+	}
+
+	result := Values{}
+	if len(root.Content) > 0 {
+		if err := result.collect("", root.Content[0]); err != nil {
+			return nil, fmt.Errorf("illegal configuration in %s: %w", file, err)
+		}
+	}
+	return result, nil
+}
+
+func (this Values) collect(prefix string, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return this.collect(prefix, node.Alias)
+	case yaml.ScalarNode:
+		if prefix == "" {
+			return fmt.Errorf("expected a map at the root but got: %s", node.Value)
+		}
+		this[prefix] = append(this[prefix], node.Value)
+		return nil
+	case yaml.SequenceNode:
+		if prefix == "" {
+			return fmt.Errorf("expected a map at the root but got a list")
+		}
+		for _, child := range node.Content {
+			if child.Kind != yaml.ScalarNode {
+				return fmt.Errorf("%s: expected a list of plain values", prefix)
+			}
+			this[prefix] = append(this[prefix], child.Value)
+		}
+		// An empty list removes the default of the flag.
+		if _, ok := this[prefix]; !ok {
+			this[prefix] = []string{}
+		}
+		return nil
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			if err := this.collect(key, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s: unsupported value", prefix)
+	}
+}
+
+// Apply uses the given values as defaults of the flags of the given
+// application. Keys which are not a flag but a prefix of one or more flags
+// followed by a single further segment are treated as map entries
+// (<key>=<value>) of the flag of this prefix, like signal.webhook.header.
+func Apply(app *kingpin.Application, values Values) error {
+	resolved := map[string][]string{}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		vs := values[key]
+		if app.GetFlag(key) != nil && !isReserved(key) {
+			resolved[key] = append(resolved[key], vs...)
+			continue
+		}
+		if i := strings.LastIndexByte(key, '.'); i > 0 && len(vs) == 1 {
+			if name := key[:i]; app.GetFlag(name) != nil && !isReserved(name) {
+				resolved[name] = append(resolved[name], key[i+1:]+"="+vs[0])
+				continue
+			}
+		}
+		return fmt.Errorf("illegal-config-key: %s", key)
+	}
+
+	for name, vs := range resolved {
+		app.GetFlag(name).Default(vs...)
+	}
+	return nil
+}
+
+func isReserved(name string) bool {
+	switch name {
+	case "config", "help", "help-long", "help-man", "completion-bash", "completion-script-bash", "completion-script-zsh", "version":
+		return true
+	default:
+		return false
+	}
+}
+
+// Dump writes the effective values of all flags of the given application as
+// YAML to the given writer. Its output can be used as a configuration file,
+// except for the values of flags marked by common.Secret which are replaced
+// by redactedValue.
+func (this *Config) Dump(app *kingpin.Application, to io.Writer) error {
+	root := map[string]any{}
+	for name, v := range SnapshotOf(app) {
+		if common.IsSecret(name) {
+			v = redacted(v)
+		}
+		put(root, strings.Split(name, "."), v)
+	}
+
+	encoder := yaml.NewEncoder(to)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return fmt.Errorf("cannot dump configuration: %w", err)
+	}
+	return encoder.Close()
+}
+
+// Snapshot holds the effective values of all flags of an application by
+// their names.
+type Snapshot map[string]any
+
+// SnapshotOf creates a Snapshot of the current values of all flags of the
+// given application.
+func SnapshotOf(app *kingpin.Application) Snapshot {
+	result := Snapshot{}
+	for _, flag := range app.Model().Flags {
+		if flag.Hidden || isReserved(flag.Name) {
+			continue
+		}
+		if v := valueOf(flag.Value); v != nil {
+			result[flag.Name] = v
+		}
+	}
+	return result
+}
+
+// Differs reports if any value of a flag starting with prefix is different
+// in other.
+func (this Snapshot) Differs(other Snapshot, prefix string) bool {
+	for _, candidates := range []Snapshot{this, other} {
+		for name := range candidates {
+			if strings.HasPrefix(name, prefix) && !reflect.DeepEqual(this[name], other[name]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const redactedValue = "***"
+
+// redacted replaces the given value by redactedValue. Of maps only the values
+// are replaced, so it is still visible which keys are set. Empty values stay
+// as they are.
+func redacted(v any) any {
+	switch typed := v.(type) {
+	case string:
+		if typed == "" {
+			return typed
+		}
+	case []string:
+		result := make([]string, len(typed))
+		for i := range typed {
+			result[i] = redactedValue
+		}
+		return result
+	case map[string]string:
+		result := make(map[string]string, len(typed))
+		for k := range typed {
+			result[k] = redactedValue
+		}
+		return result
+	}
+	return redactedValue
+}
+
+func put(target map[string]any, path []string, value any) {
+	if len(path) == 1 {
+		target[path[0]] = value
+		return
+	}
+	child, ok := target[path[0]].(map[string]any)
+	if !ok {
+		if _, exists := target[path[0]]; exists {
+			// This name is a flag itself; keep the rest flat beside it.
+			target[strings.Join(path, ".")] = value
+			return
+		}
+		child = map[string]any{}
+		target[path[0]] = child
+	}
+	put(child, path[1:], value)
+}
+
+func valueOf(v kingpin.Value) any {
+	if sv, ok := v.(interface{ Strings() []string }); ok {
+		return sv.Strings()
+	}
+	if gv, ok := v.(kingpin.Getter); ok {
+		switch typed := gv.Get().(type) {
+		case bool, string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, []string, map[string]string:
+			return typed
+		case *[]string:
+			// Flags which accept multiple values, like Strings().
+			return *typed
+		case time.Duration:
+			return typed.String()
+		case *regexp.Regexp:
+			if typed == nil {
+				return ""
+			}
+			return typed.String()
+		}
+	}
+	if v := v.String(); v != "" {
+		return v
+	}
+	// Custom values without a value cannot be restored from an empty string.
+	return nil
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bytes"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		expected Values
+	}{{
+		name: "nested and dotted keys",
+		content: `
+audio:
+  type: pulse
+signal.type: record
+signal:
+  hue:
+    muted:
+      hue: 0
+  record.file: /tmp/record.jsonl
+`,
+		expected: Values{
+			"audio.type":           {"pulse"},
+			"signal.type":          {"record"},
+			"signal.hue.muted.hue": {"0"},
+			"signal.record.file":   {"/tmp/record.jsonl"},
+		},
+	}, {
+		name:     "json",
+		content:  `{"audio": {"type": "fake"}, "signal.type": ["hue", "record"]}`,
+		expected: Values{"audio.type": {"fake"}, "signal.type": {"hue", "record"}},
+	}, {
+		name: "lists",
+		content: `
+signal:
+  type: [hue, record]
+excludedSessions:
+- process=zoom
+- user=root
+`,
+		expected: Values{
+			"signal.type":      {"hue", "record"},
+			"excludedSessions": {"process=zoom", "user=root"},
+		},
+	}, {
+		name:     "empty list",
+		content:  `signal: {type: []}`,
+		expected: Values{"signal.type": {}},
+	}, {
+		name: "map",
+		content: `
+signal:
+  webhook.header:
+    Authorization: Bearer foo
+    X-Foo: bar
+`,
+		expected: Values{
+			"signal.webhook.header.Authorization": {"Bearer foo"},
+			"signal.webhook.header.X-Foo":         {"bar"},
+		},
+	}, {
+		name: "aliases",
+		content: `
+colour: &colour
+  brightness: 100
+  hue: 6000
+signal:
+  hue:
+    muted: *colour
+    speaking: *colour
+`,
+		expected: Values{
+			"colour.brightness":              {"100"},
+			"colour.hue":                     {"6000"},
+			"signal.hue.muted.brightness":    {"100"},
+			"signal.hue.muted.hue":           {"6000"},
+			"signal.hue.speaking.brightness": {"100"},
+			"signal.hue.speaking.hue":        {"6000"},
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := Load(configTestFile(t, c.content))
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("Load() = %v; want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func TestLoad_illegal(t *testing.T) {
+	for _, content := range []string{
+		`just a value`,
+		`[a, b]`,
+		`signal: {type: [[hue]]}`,
+		`signal: {type: [hue`,
+	} {
+		if _, err := Load(configTestFile(t, content)); err == nil {
+			t.Errorf("Load(%q) should fail", content)
+		}
+	}
+}
+
+func TestConfig_Prepare(t *testing.T) {
+	file := configTestFile(t, `
+test:
+  name: from-file
+  env: from-file
+  flag: from-file
+  interval: 1m
+  type: []
+  header:
+    Authorization: Bearer foo
+`)
+	t.Setenv("TI_TEST_ENV", "from-env")
+	t.Setenv("TI_TEST_FLAG", "from-env")
+
+	var c Config
+	app := kingpin.New("test", "")
+	// Like SetupConfiguration, but without the command, which would be
+	// required to be selected otherwise.
+	app.Flag("config", "").StringVar(&c.File)
+	name := app.Flag("test.name", "").Default("default").String()
+	env := app.Flag("test.env", "").Envar("TI_TEST_ENV").String()
+	flag := app.Flag("test.flag", "").Envar("TI_TEST_FLAG").String()
+	untouched := app.Flag("test.untouched", "").Default("default").String()
+	interval := app.Flag("test.interval", "").Default("5s").Duration()
+	types := app.Flag("test.type", "").Default("a", "b").Strings()
+	header := app.Flag("test.header", "").StringMap()
+
+	args := []string{"--config=" + file, "--test.flag=from-flag"}
+	if err := c.Prepare(app, args); err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	if _, err := app.Parse(args); err != nil {
+		t.Fatalf("cannot parse arguments: %v", err)
+	}
+
+	// Flags win over environment variables, which win over the file, which
+	// wins over the defaults.
+	for flagName, actual := range map[string]string{"from-file": *name, "from-env": *env, "from-flag": *flag, "default": *untouched} {
+		if actual != flagName {
+			t.Errorf("value = %q; want %q", actual, flagName)
+		}
+	}
+	if *interval != time.Minute {
+		t.Errorf("interval = %v; want 1m", *interval)
+	}
+	if len(*types) != 0 {
+		t.Errorf("type = %v; want it emptied by the file", *types)
+	}
+	if expected := map[string]string{"Authorization": "Bearer foo"}; !reflect.DeepEqual(*header, expected) {
+		t.Errorf("header = %v; want %v", *header, expected)
+	}
+}
+
+func TestApply_illegalKey(t *testing.T) {
+	app := kingpin.New("test", "")
+	app.Flag("test.name", "").String()
+
+	for _, values := range []Values{
+		{"test.unknown": {"foo"}},
+		{"config": {"other.yaml"}},
+		// Only single values are map entries.
+		{"test.name.foo": {"a", "b"}},
+	} {
+		if err := Apply(app, values); err == nil {
+			t.Errorf("Apply(%v) should fail", values)
+		}
+	}
+}
+
+func TestConfig_Dump(t *testing.T) {
+	var c Config
+	app := kingpin.New("test", "")
+	app.Flag("test.name", "").Default("default").String()
+	app.Flag("test.interval", "").Default("5s").Duration()
+	app.Flag("test.type", "").Default("a", "b").Strings()
+	app.Flag("test.kind", "").Default("a", "b").Strings()
+	if err := Apply(app, Values{"test.name": {"from-file"}}); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	if _, err := app.Parse([]string{"--test.type=c"}); err != nil {
+		t.Fatalf("cannot parse arguments: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Dump(app, &buf); err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+
+	expected := "test:\n  interval: 5s\n  kind:\n    - a\n    - b\n  name: from-file\n  type:\n    - c\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("Dump() =\n%s\nwant:\n%s", actual, expected)
+	}
+}
+
+func TestConfig_Dump_redactsSecrets(t *testing.T) {
+	var c Config
+	app := kingpin.New("test", "")
+	app.Flag("test.user", "").String()
+	common.Secret(app.Flag("test.password", "")).String()
+	common.Secret(app.Flag("test.header", "")).StringMap()
+	common.Secret(app.Flag("test.token", "")).String()
+	if _, err := app.Parse([]string{
+		"--test.user=alice",
+		"--test.password=geheim",
+		"--test.header=Authorization=Bearer geheim",
+	}); err != nil {
+		t.Fatalf("cannot parse arguments: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Dump(app, &buf); err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+	actual := buf.String()
+
+	if strings.Contains(actual, "geheim") {
+		t.Errorf("Dump() contains secret:\n%s", actual)
+	}
+	for _, expected := range []string{
+		"user: alice\n",
+		"password: '***'\n",
+		"Authorization: '***'\n",
+		"token: \"\"\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("Dump() does not contain %q:\n%s", expected, actual)
+		}
+	}
+
+	// Changes of secrets have still to be detected while reloading.
+	if snapshot := SnapshotOf(app); snapshot["test.password"] != "geheim" {
+		t.Errorf("SnapshotOf()[test.password] = %v; want geheim", snapshot["test.password"])
+	}
+}
+
+func configTestFile(t *testing.T, content string) string {
+	t.Helper()
+	result := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(result, []byte(content), 0644); err != nil {
+		t.Fatalf("cannot write configuration: %v", err)
+	}
+	return result
+}
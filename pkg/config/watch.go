@@ -0,0 +1,49 @@
+package config
+
+import (
+	"context"
+	log "github.com/echocat/slf4g"
+	"os"
+	"time"
+)
+
+// Watch emits every time the configuration file was changed. The file is
+// checked every WatchInterval; if there is no file or WatchInterval is 0 the
+// returned channel never emits.
+func (this *Config) Watch(ctx context.Context) <-chan struct{} {
+	result := make(chan struct{})
+	if this.File == "" || this.WatchInterval <= 0 {
+		return result
+	}
+
+	go func() {
+		last, _ := os.Stat(this.File)
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("Configuration watch interrupted.")
+				return
+			case <-time.After(this.WatchInterval):
+			}
+
+			current, err := os.Stat(this.File)
+			if err != nil {
+				// Editors might replace the file; wait until it is back.
+				continue
+			}
+			if last != nil && current.ModTime().Equal(last.ModTime()) && current.Size() == last.Size() {
+				continue
+			}
+			last = current
+
+			log.With("file", this.File).
+				Debug("Configuration file changed.")
+			select {
+			case <-ctx.Done():
+				return
+			case result <- struct{}{}:
+			}
+		}
+	}()
+	return result
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"time"
+)
+
+const namespace = "talk_indicator"
+
+var (
+	// Registry contains all metrics of this application (including the ones
+	// of the Go runtime and the process).
+	Registry = prometheus.NewRegistry()
+
+	State = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "state",
+		Help:      "1 for the state which is currently signaled, 0 for all others.",
+	}, []string{"state"})
+	Overridden = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "overridden",
+		Help:      "1 if the state is currently pinned by an override, otherwise 0.",
+	})
+	ActiveSessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Number of relevant sessions per device.",
+	}, []string{"kind", "device"})
+	StateTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "state_transitions_total",
+		Help:      "Number of transitions between the signaled states.",
+	}, []string{"from", "to"})
+	SignalErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signal_errors_total",
+		Help:      "Number of failed operations per signal type.",
+	}, []string{"type", "operation"})
+	FindDevicesDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "find_devices_duration_seconds",
+		Help:      "Duration of finding the devices and their sessions.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"kind", "type"})
+	HueRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hue_request_duration_seconds",
+		Help:      "Duration of requests to the hue bridge.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		State,
+		Overridden,
+		ActiveSessions,
+		StateTransitions,
+		SignalErrors,
+		FindDevicesDuration,
+		HueRequestDuration,
+	)
+}
+
+// Observe records the duration since start at the given histogram.
+func Observe(histogram prometheus.Observer, start time.Time) {
+	histogram.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,72 @@
+package rule
+
+import (
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"strings"
+	"time"
+)
+
+// Environment is what the expression of each Rule has access to. It is
+// evaluated once for each relevant session. If there is no relevant session
+// at all it is evaluated exactly once with active being false.
+type Environment struct {
+	Active  bool    `expr:"active"`
+	Device  Device  `expr:"device"`
+	Session Session `expr:"session"`
+
+	Now     time.Time `expr:"now"`
+	Time    string    `expr:"time"`
+	Weekday string    `expr:"weekday"`
+}
+
+type Device struct {
+	Name  string `expr:"name"`
+	Index int    `expr:"index"`
+	Muted bool   `expr:"muted"`
+}
+
+type Session struct {
+	Kind       string  `expr:"kind"`
+	Identifier string  `expr:"identifier"`
+	Pid        int     `expr:"pid"`
+	Process    string  `expr:"process"`
+	Path       string  `expr:"path"`
+	Cmdline    string  `expr:"cmdline"`
+	User       string  `expr:"user"`
+	Muted      bool    `expr:"muted"`
+	Peak       float64 `expr:"peak"`
+}
+
+const (
+	SessionKindAudio = "audio"
+	SessionKindVideo = "video"
+)
+
+func newEnvironment(now time.Time) Environment {
+	return Environment{
+		Now:     now,
+		Time:    now.Format("15:04"),
+		Weekday: strings.ToLower(now.Weekday().String()),
+	}
+}
+
+func (this Environment) with(kind string, device audio.Device, session audio.Session) Environment {
+	this.Active = true
+	this.Device = Device{
+		Name:  device.Name,
+		Index: int(device.Index),
+		Muted: device.Muted,
+	}
+	this.Session = Session{
+		Kind:       kind,
+		Identifier: session.Identifier,
+		Pid:        int(session.HolderPid),
+		Process:    session.ProcessName,
+		Path:       session.ExecutablePath,
+		Cmdline:    session.CommandLine,
+		User:       session.User,
+		Muted:      session.Muted,
+		Peak:       float64(session.Peak),
+	}
+	return this
+}
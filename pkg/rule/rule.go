@@ -0,0 +1,119 @@
+package rule
+
+import (
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"gopkg.in/yaml.v3"
+	"os"
+	"time"
+)
+
+// Rule maps a condition to the State which should be signaled if it is true.
+// When is an expression (see https://expr-lang.org) which has access to the
+// fields of Environment. Example: session.process in ["zoom", "teams"] && time >= "09:00"
+type Rule struct {
+	Name  string       `json:"name,omitempty" yaml:"name,omitempty"`
+	When  string       `json:"when" yaml:"when"`
+	State signal.State `json:"state" yaml:"state"`
+
+	program *vm.Program
+}
+
+func (this Rule) String() string {
+	if v := this.Name; v != "" {
+		return v
+	}
+	return this.When
+}
+
+func (this *Rule) compile() error {
+	program, err := expr.Compile(this.When, expr.Env(Environment{}), expr.AsBool())
+	if err != nil {
+		return err
+	}
+	this.program = program
+	return nil
+}
+
+func (this *Rule) matches(env Environment) (bool, error) {
+	if this.program == nil {
+		if err := this.compile(); err != nil {
+			return false, err
+		}
+	}
+	result, err := expr.Run(this.program, env)
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// Rules is an ordered list of Rule; the first matching one wins.
+type Rules []Rule
+
+// Load reads all rules from the given YAML or JSON file and validates them.
+func Load(file string) (Rules, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read rules from %s: %w", file, err)
+	}
+
+	var result Rules
+	if err := yaml.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("cannot parse rules of %s: %w", file, err)
+	}
+	if err := result.Validate(); err != nil {
+		return nil, fmt.Errorf("illegal rules in %s: %w", file, err)
+	}
+
+	return result, nil
+}
+
+// Validate compiles all rules and fails on the first one which is not valid.
+func (this Rules) Validate() error {
+	for i := range this {
+		if err := this[i].compile(); err != nil {
+			return fmt.Errorf("rule #%d (%v): %w", i+1, this[i], err)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the State of the first Rule which matches any relevant
+// session of the given devices together with the Rule itself. If no rule
+// matches StateOff and nil is returned.
+func (this Rules) Evaluate(audioDevices, videoDevices audio.Devices, isRelevant func(*audio.Session) bool, now time.Time) (signal.State, *Rule, error) {
+	base := newEnvironment(now)
+	var envs []Environment
+	collect := func(kind string, devices audio.Devices) {
+		for _, device := range devices {
+			for _, session := range device.Sessions {
+				if isRelevant(&session) {
+					envs = append(envs, base.with(kind, device, session))
+				}
+			}
+		}
+	}
+	collect(SessionKindAudio, audioDevices)
+	collect(SessionKindVideo, videoDevices)
+	if len(envs) == 0 {
+		envs = append(envs, base)
+	}
+
+	for i := range this {
+		for _, env := range envs {
+			ok, err := this[i].matches(env)
+			if err != nil {
+				return signal.StateOff, nil, fmt.Errorf("cannot evaluate rule #%d (%v): %w", i+1, this[i], err)
+			}
+			if ok {
+				return this[i].State, &this[i], nil
+			}
+		}
+	}
+
+	return signal.StateOff, nil, nil
+}
@@ -0,0 +1,203 @@
+package rule
+
+import (
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"github.com/blaubaer/talk-indicator/pkg/signal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		expected string
+	}{{
+		name: "yaml",
+		content: `
+- name: meeting
+  when: session.process in ["zoom", "teams"]
+  state: on
+- when: active && time >= "09:00"
+  state: muted
+`,
+	}, {
+		name:    "json",
+		content: `[{"name":"meeting","when":"session.process == \"zoom\"","state":"camera"}]`,
+	}, {
+		name:     "syntax error",
+		content:  `[{"name":"broken","when":"session.process ==","state":"on"}]`,
+		expected: "rule #1 (broken)",
+	}, {
+		name:     "not a boolean",
+		content:  `[{"when":"true","state":"on"},{"when":"session.process","state":"on"}]`,
+		expected: "rule #2 (session.process)",
+	}, {
+		name:     "unknown field",
+		content:  `[{"when":"session.application == \"zoom\"","state":"on"}]`,
+		expected: "rule #1",
+	}, {
+		name:     "unknown state",
+		content:  `[{"when":"active","state":"blinking"}]`,
+		expected: "illegal-signal-state: blinking",
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(file, []byte(c.content), 0644); err != nil {
+				t.Fatalf("cannot write rules: %v", err)
+			}
+
+			_, err := Load(file)
+			if c.expected == "" && err != nil {
+				t.Errorf("Load() failed: %v", err)
+			}
+			if c.expected != "" && (err == nil || !strings.Contains(err.Error(), c.expected)) {
+				t.Errorf("Load() = %v; want error containing %q", err, c.expected)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("Load() of missing file should fail")
+	}
+}
+
+func TestRules_Evaluate(t *testing.T) {
+	// A Monday morning.
+	now := time.Date(2026, 1, 5, 9, 30, 0, 0, time.Local)
+	microphone := audio.Devices{{
+		Name:  "Microphone",
+		Index: 1,
+		Sessions: audio.Sessions{
+			{Identifier: "firefox|4711", HolderPid: 4711, ProcessName: "firefox"},
+			{Identifier: "zoom|815", HolderPid: 815, ProcessName: "zoom", Muted: true},
+		},
+	}}
+	mutedMicrophone := audio.Devices{{
+		Name:     "Microphone",
+		Index:    1,
+		Muted:    true,
+		Sessions: audio.Sessions{{Identifier: "zoom|815", ProcessName: "zoom"}},
+	}}
+	camera := audio.Devices{{
+		Name:     "Camera",
+		Sessions: audio.Sessions{{Identifier: "/dev/video0", ProcessName: "teams"}},
+	}}
+
+	cases := []struct {
+		name          string
+		rules         string
+		audio         audio.Devices
+		video         audio.Devices
+		relevant      func(*audio.Session) bool
+		expected      signal.State
+		expectedMatch string
+	}{{
+		name: "first match wins",
+		rules: `
+- {name: first, when: 'session.process == "zoom"', state: muted}
+- {name: second, when: 'session.process == "firefox"', state: speaking}
+`,
+		audio:         microphone,
+		expected:      signal.StateMuted,
+		expectedMatch: "first",
+	}, {
+		name: "order of rules wins over order of sessions",
+		rules: `
+- {name: first, when: 'session.process == "firefox"', state: speaking}
+- {name: second, when: 'session.process == "zoom"', state: muted}
+`,
+		audio:         microphone,
+		expected:      signal.StateSpeaking,
+		expectedMatch: "first",
+	}, {
+		name:     "falls through to off",
+		rules:    `[{name: never, when: 'session.process == "teams"', state: on}]`,
+		audio:    microphone,
+		expected: signal.StateOff,
+	}, {
+		name:          "without any session",
+		rules:         `[{name: idle, when: '!active', state: muted}]`,
+		expected:      signal.StateMuted,
+		expectedMatch: "idle",
+	}, {
+		name:     "irrelevant sessions are ignored",
+		rules:    `[{name: zoom, when: 'session.process == "zoom"', state: on}]`,
+		audio:    microphone,
+		relevant: func(s *audio.Session) bool { return s.ProcessName != "zoom" },
+		expected: signal.StateOff,
+	}, {
+		name:          "device",
+		rules:         `[{name: device, when: 'device.muted && device.name == "Microphone" && device.index == 1', state: muted}]`,
+		audio:         mutedMicrophone,
+		expected:      signal.StateMuted,
+		expectedMatch: "device",
+	}, {
+		name:          "session",
+		rules:         `[{name: session, when: 'session.kind == "audio" && session.pid == 815 && session.muted && session.identifier startsWith "zoom|"', state: muted}]`,
+		audio:         microphone,
+		expected:      signal.StateMuted,
+		expectedMatch: "session",
+	}, {
+		name:          "video session",
+		rules:         `[{name: video, when: 'session.kind == "video" && session.process == "teams"', state: camera}]`,
+		audio:         microphone,
+		video:         camera,
+		expected:      signal.StateCamera,
+		expectedMatch: "video",
+	}, {
+		name:          "time and weekday",
+		rules:         `[{name: office hours, when: 'weekday == "monday" && time >= "09:00" && time < "17:00" && now.Hour() == 9', state: on}]`,
+		audio:         microphone,
+		expected:      signal.StateOn,
+		expectedMatch: "office hours",
+	}, {
+		name:     "outside of time",
+		rules:    `[{name: weekend, when: 'weekday in ["saturday", "sunday"]', state: on}]`,
+		audio:    microphone,
+		expected: signal.StateOff,
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rules := ruleTestLoad(t, c.rules)
+			relevant := c.relevant
+			if relevant == nil {
+				relevant = func(*audio.Session) bool { return true }
+			}
+
+			actual, matched, err := rules.Evaluate(c.audio, c.video, relevant, now)
+			if err != nil {
+				t.Fatalf("Evaluate() failed: %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Evaluate() = %v; want %v", actual, c.expected)
+			}
+			var actualMatch string
+			if matched != nil {
+				actualMatch = matched.Name
+			}
+			if actualMatch != c.expectedMatch {
+				t.Errorf("matched rule = %q; want %q", actualMatch, c.expectedMatch)
+			}
+		})
+	}
+}
+
+func ruleTestLoad(t *testing.T, content string) Rules {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("cannot write rules: %v", err)
+	}
+	result, err := Load(file)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,17 @@
+package signal
+
+import "fmt"
+
+// Error is returned by Facade for each selected Signal which failed.
+type Error struct {
+	Type  Type
+	Cause error
+}
+
+func (this *Error) Error() string {
+	return fmt.Sprintf("signal %v: %v", this.Type, this.Cause)
+}
+
+func (this *Error) Unwrap() error {
+	return this.Cause
+}
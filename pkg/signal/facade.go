@@ -1,16 +1,27 @@
 package signal
 
 import (
+	"errors"
 	"fmt"
 	"github.com/blaubaer/talk-indicator/pkg/common"
+	"github.com/blaubaer/talk-indicator/pkg/metrics"
+	log "github.com/echocat/slf4g"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Facade struct {
-	Signal
+	Signals []Signal
 
 	initialized sync.Once
 	typeFacade  facadeTypeFacade
+	health      map[Signal]*Health
+	failed      map[Signal]error
+	healthMutex sync.RWMutex
+
+	workers      map[Signal]*facadeWorker
+	workersMutex sync.Mutex
 }
 
 func (this *Facade) SetupConfiguration(using common.FlagHolder) {
@@ -18,19 +29,261 @@ func (this *Facade) SetupConfiguration(using common.FlagHolder) {
 	this.typeFacade.SetupConfiguration(using)
 }
 
+// Initialize initializes every selected signal. Signals which fail are
+// logged, reported as unhealthy and left out until a later Update was able
+// to initialize them. It only fails if none of the signals could be
+// initialized.
 func (this *Facade) Initialize() error {
 	this.ensure()
-	return this.Signal.Initialize()
+
+	this.healthMutex.Lock()
+	this.failed = make(map[Signal]error)
+	this.healthMutex.Unlock()
+
+	errs := this.initialize(this.Signals)
+	if len(this.Signals) > 0 && len(this.active()) == 0 {
+		return errors.Join(errs...)
+	}
+	return nil
 }
 
+func (this *Facade) initialize(signals []Signal) []error {
+	errs := this.each("initialize", signals, Signal.Initialize)
+
+	this.healthMutex.Lock()
+	defer this.healthMutex.Unlock()
+	for i, s := range signals {
+		if err := errs[i]; err != nil {
+			log.WithError(err).
+				With("signal", s.GetType()).
+				Error("Cannot initialize signal. Continue without it until the next refresh.")
+			this.failed[s] = err
+		} else {
+			delete(this.failed, s)
+		}
+	}
+	return errs
+}
+
+// Dispose disposes every selected signal after they ensured the last state
+// handed over by Ensure.
 func (this *Facade) Dispose() error {
 	this.ensure()
-	return this.Signal.Dispose()
+	this.await()
+	return errors.Join(this.each("dispose", this.Signals, Signal.Dispose)...)
+}
+
+// Ensure hands the given state over to every initialized signal and returns
+// without waiting for them, so a slow or unreachable one delays neither the
+// others nor the caller. Each signal only ensures the latest state it was
+// handed over; failures are logged and reported by Health.
+func (this *Facade) Ensure(state State) {
+	this.ensure()
+	for _, s := range this.active() {
+		this.workerOf(s).handOver(state)
+	}
+}
+
+func (this *Facade) workerOf(s Signal) *facadeWorker {
+	this.workersMutex.Lock()
+	defer this.workersMutex.Unlock()
+
+	result := this.workers[s]
+	if result == nil {
+		result = newFacadeWorker(s, this.apply)
+		this.workers[s] = result
+	}
+	return result
+}
+
+func (this *Facade) apply(s Signal, state State) {
+	errs := this.each("ensure", []Signal{s}, func(s Signal) error {
+		return s.Ensure(state)
+	})
+	if err := errs[0]; err != nil {
+		log.WithError(err).
+			With("signal", s.GetType()).
+			With("state", state).
+			Error("Cannot ensure signal state.")
+	}
+}
+
+// await blocks until every signal ensured the last state handed over by
+// Ensure.
+func (this *Facade) await() {
+	this.workersMutex.Lock()
+	workers := make([]*facadeWorker, 0, len(this.workers))
+	for _, w := range this.workers {
+		workers = append(workers, w)
+	}
+	this.workersMutex.Unlock()
+
+	for _, w := range workers {
+		w.await()
+	}
+}
+
+// EnsureTargets ensures the given state at every selected signal and
+// reports the result of each target. Signals which are not a TargetedSignal
+// are reported as one target.
+func (this *Facade) EnsureTargets(state State) []TargetResult {
+	this.ensure()
+	var result []TargetResult
+	for _, s := range this.Signals {
+		if err := this.initializationFailure(s); err != nil {
+			result = append(result, TargetResult{Type: s.GetType(), Target: s.GetType().String(), Error: fmt.Errorf("not initialized: %w", err)})
+		} else if ts, ok := s.(TargetedSignal); ok {
+			results := ts.EnsureTargets(state)
+			var errs []error
+			for _, r := range results {
+				errs = append(errs, r.Error)
+			}
+			this.record(s, errors.Join(errs...))
+			result = append(result, results...)
+		} else {
+			err := s.Ensure(state)
+			this.record(s, err)
+			result = append(result, TargetResult{Type: s.GetType(), Target: s.GetType().String(), Error: err})
+		}
+	}
+	return result
+}
+
+// Release switches every target of this instance off which is not addressed
+// by successor, too, as it would stay in its last state forever otherwise.
+// Signals which are not a ReplaceableSignal are switched off completely.
+func (this *Facade) Release(successor *Facade) error {
+	this.ensure()
+	// States still pending must not arrive after the release.
+	this.await()
+	return errors.Join(this.each("release", this.active(), func(s Signal) error {
+		if rs, ok := s.(ReplaceableSignal); ok {
+			return rs.Release(successor.activeOf(s.GetType()))
+		}
+		return s.Ensure(StateOff)
+	})...)
+}
+
+// Update tries to initialize the signals which failed before and updates all
+// the others.
+func (this *Facade) Update() error {
+	this.ensure()
+
+	this.healthMutex.RLock()
+	var failed []Signal
+	for _, s := range this.Signals {
+		if _, ok := this.failed[s]; ok {
+			failed = append(failed, s)
+		}
+	}
+	this.healthMutex.RUnlock()
+
+	active := this.active()
+	if len(failed) > 0 {
+		this.initialize(failed)
+	}
+	return errors.Join(this.each("update", active, Signal.Update)...)
+}
+
+// active returns all selected signals which were initialized successfully.
+func (this *Facade) active() []Signal {
+	this.healthMutex.RLock()
+	defer this.healthMutex.RUnlock()
+
+	result := make([]Signal, 0, len(this.Signals))
+	for _, s := range this.Signals {
+		if _, failed := this.failed[s]; !failed {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// activeOf returns the initialized signal of the given Type; nil if there is
+// none.
+func (this *Facade) activeOf(t Type) Signal {
+	if this == nil {
+		return nil
+	}
+	for _, s := range this.active() {
+		if s.GetType() == t {
+			return s
+		}
+	}
+	return nil
+}
+
+func (this *Facade) initializationFailure(s Signal) error {
+	this.healthMutex.RLock()
+	defer this.healthMutex.RUnlock()
+	return this.failed[s]
+}
+
+// Variant returns the instance of the given Type, regardless of whether it
+// is selected or not.
+func (this *Facade) Variant(t Type) Signal {
+	this.ensure()
+	return this.typeFacade.allVariants[t]
 }
 
-func (this *Facade) GetType() Type {
+func (this *Facade) GetTypes() Types {
 	this.ensure()
-	return this.Signal.GetType()
+	result := make(Types, len(this.Signals))
+	for i, s := range this.Signals {
+		result[i] = s.GetType()
+	}
+	return result
+}
+
+// Health returns the Health of every selected signal.
+func (this *Facade) Health() []Health {
+	this.ensure()
+	this.healthMutex.RLock()
+	defer this.healthMutex.RUnlock()
+
+	result := make([]Health, len(this.Signals))
+	for i, s := range this.Signals {
+		if v := this.health[s]; v != nil {
+			result[i] = *v
+		} else {
+			result[i] = Health{Type: s.GetType(), Healthy: true}
+		}
+	}
+	return result
+}
+
+// each calls action for all given signals concurrently, even if some of them
+// are failing. The failure of each signal is returned at its index as an
+// *Error; nil if it succeeded.
+func (this *Facade) each(operation string, signals []Signal, action func(Signal) error) []error {
+	errs := make([]error, len(signals))
+	var wg sync.WaitGroup
+	for i, s := range signals {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := action(s)
+			this.record(s, err)
+			if err != nil {
+				metrics.SignalErrors.WithLabelValues(s.GetType().String(), operation).Inc()
+				errs[i] = &Error{Type: s.GetType(), Cause: err}
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func (this *Facade) record(s Signal, err error) {
+	this.healthMutex.Lock()
+	defer this.healthMutex.Unlock()
+
+	v := this.health[s]
+	if v == nil {
+		v = &Health{Type: s.GetType()}
+		this.health[s] = v
+	}
+	v.record(err, time.Now())
 }
 
 func (this *Facade) ensure() {
@@ -40,34 +293,68 @@ func (this *Facade) ensure() {
 		for _, t := range AllTypes {
 			this.typeFacade.allVariants[t] = t.newInstance()
 		}
-		this.Signal = this.typeFacade.allVariants[TypeDefault]
+		this.Signals = []Signal{this.typeFacade.allVariants[TypeDefault]}
+		this.health = make(map[Signal]*Health, len(AllTypes))
+		this.failed = make(map[Signal]error)
+		this.workers = make(map[Signal]*facadeWorker, len(AllTypes))
 	})
 }
 
 type facadeTypeFacade struct {
 	owner       *Facade
 	allVariants map[Type]Signal
+	set         bool
 }
 
 func (this *facadeTypeFacade) Set(plain string) error {
-	var t Type
-	if err := t.Set(plain); err != nil {
-		return err
+	if !this.set {
+		// The first explicit value replaces the default.
+		this.owner.Signals = nil
+		this.set = true
 	}
-	s, ok := this.allVariants[t]
-	if !ok {
-		return fmt.Errorf("illegal-signal-tyle: %s", plain)
+	for _, plain := range strings.Split(plain, ",") {
+		plain = strings.TrimSpace(plain)
+		if plain == "" {
+			continue
+		}
+		var t Type
+		if err := t.Set(plain); err != nil {
+			return err
+		}
+		s, ok := this.allVariants[t]
+		if !ok {
+			return fmt.Errorf("illegal-signal-type: %s", plain)
+		}
+		if !this.has(s) {
+			this.owner.Signals = append(this.owner.Signals, s)
+		}
 	}
-	this.owner.Signal = s
 	return nil
 }
 
+func (this *facadeTypeFacade) has(s Signal) bool {
+	for _, candidate := range this.owner.Signals {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *facadeTypeFacade) Strings() []string {
+	return this.owner.GetTypes().Strings()
+}
+
 func (this *facadeTypeFacade) String() string {
-	return this.owner.Signal.GetType().String()
+	return this.owner.GetTypes().String()
+}
+
+func (this *facadeTypeFacade) IsCumulative() bool {
+	return true
 }
 
 func (this *facadeTypeFacade) SetupConfiguration(using common.FlagHolder) {
-	using.Flag("signal.type", fmt.Sprintf("Type how the signal should be sent. Possible values: %v", AllTypes)).
+	using.Flag("signal.type", fmt.Sprintf("Type(s) how the signal should be sent. Multiple types can be combined using commas. Possible values: %v", AllTypes)).
 		Default(TypeDefault.String()).
 		Envar("TI_SIGNAL_TYPE").
 		SetValue(this)
@@ -0,0 +1,247 @@
+package signal
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFacade_Initialize_continuesWithoutFailingSignals(t *testing.T) {
+	healthy := &facadeTestSignal{typ: TypeRecord}
+	failing := &facadeTestSignal{typ: TypeWebhook, initializeErr: errors.New("expected")}
+	instance := newFacadeTestInstance(healthy, failing)
+
+	if err := instance.Initialize(); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+	instance.Ensure(StateOn)
+	instance.await()
+
+	if actual := healthy.ensured(); !slices.Equal(actual, []State{StateOn}) {
+		t.Errorf("healthy signal ensured %v; want [on]", actual)
+	}
+	if actual := failing.ensured(); len(actual) > 0 {
+		t.Errorf("failing signal ensured %v; want nothing", actual)
+	}
+
+	health := instance.Health()
+	if !health[0].Healthy || health[1].Healthy {
+		t.Errorf("Health() = %+v; want first healthy and second unhealthy", health)
+	}
+
+	results := instance.EnsureTargets(StateOff)
+	if len(results) != 2 || results[0].Error != nil || results[1].Error == nil {
+		t.Errorf("EnsureTargets() = %+v; want error only for second", results)
+	}
+}
+
+func TestFacade_Initialize_failsIfAllFail(t *testing.T) {
+	instance := newFacadeTestInstance(
+		&facadeTestSignal{typ: TypeRecord, initializeErr: errors.New("expected")},
+		&facadeTestSignal{typ: TypeWebhook, initializeErr: errors.New("expected")},
+	)
+
+	err := instance.Initialize()
+	if err == nil {
+		t.Fatalf("Initialize() should fail")
+	}
+	if _, ok := common.AsError[*Error](err); !ok {
+		t.Errorf("Initialize() = %v; want *Error", err)
+	}
+}
+
+func TestFacade_Update_retriesFailedInitialization(t *testing.T) {
+	healthy := &facadeTestSignal{typ: TypeRecord}
+	failing := &facadeTestSignal{typ: TypeWebhook, initializeErr: errors.New("expected")}
+	instance := newFacadeTestInstance(healthy, failing)
+
+	if err := instance.Initialize(); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+
+	failing.setInitializeErr(nil)
+	if err := instance.Update(); err != nil {
+		t.Fatalf("Update() failed: %v", err)
+	}
+	instance.Ensure(StateOn)
+	instance.await()
+
+	if actual := failing.ensured(); !slices.Equal(actual, []State{StateOn}) {
+		t.Errorf("recovered signal ensured %v; want [on]", actual)
+	}
+	if health := instance.Health(); !health[1].Healthy {
+		t.Errorf("Health() = %+v; want recovered signal healthy", health)
+	}
+}
+
+func TestFacade_Ensure_notBlockedBySignal(t *testing.T) {
+	unblock := make(chan struct{})
+	blocking := &facadeTestSignal{typ: TypeWebhook, block: unblock}
+	other := &facadeTestSignal{typ: TypeRecord}
+	instance := newFacadeTestInstance(blocking, other)
+
+	if err := instance.Initialize(); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		instance.Ensure(StateOn)
+		facadeTestWaitFor(t, other, StateOn)
+		instance.Ensure(StateSpeaking)
+		facadeTestWaitFor(t, other, StateOn, StateSpeaking)
+		instance.Ensure(StateOff)
+		facadeTestWaitFor(t, other, StateOn, StateSpeaking, StateOff)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Ensure() blocked by signal")
+	}
+
+	// The blocking signal only ensures the latest of the states which were
+	// handed over while it was busy.
+	close(unblock)
+	instance.await()
+	if actual := blocking.ensured(); !slices.Equal(actual, []State{StateOn, StateOff}) {
+		t.Errorf("blocking signal ensured %v; want [on off]", actual)
+	}
+}
+
+func facadeTestWaitFor(t *testing.T, s *facadeTestSignal, expected ...State) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.Equal(s.ensured(), expected) {
+		if time.Now().After(deadline) {
+			t.Errorf("signal ensured %v; want %v", s.ensured(), expected)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFacade_Release(t *testing.T) {
+	cases := []struct {
+		name        string
+		sameFile    bool
+		switchesOff bool
+	}{
+		{"same target", true, false},
+		{"other target", false, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "old.jsonl")
+			nextFile := filepath.Join(t.TempDir(), "next.jsonl")
+			if c.sameFile {
+				nextFile = file
+			}
+			other := &facadeTestSignal{typ: TypeWebhook}
+			old := newFacadeTestInstance(&Record{File: file}, other)
+			next := newFacadeTestInstance(&Record{File: nextFile})
+			for _, v := range []*Facade{old, next} {
+				if err := v.Initialize(); err != nil {
+					t.Fatalf("Initialize() failed: %v", err)
+				}
+			}
+			old.Ensure(StateOn)
+
+			if err := old.Release(next); err != nil {
+				t.Fatalf("Release() failed: %v", err)
+			}
+
+			// Signals which cannot tell their targets are always switched off.
+			if actual := other.ensured(); !slices.Equal(actual, []State{StateOn, StateOff}) {
+				t.Errorf("other signal ensured %v; want [on off]", actual)
+			}
+			if actual := facadeTestRecorded(t, file, StateOff); actual != c.switchesOff {
+				t.Errorf("record switched off = %v; want %v", actual, c.switchesOff)
+			}
+		})
+	}
+}
+
+func facadeTestRecorded(t *testing.T, file string, state State) bool {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("cannot read record: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var entry RecordEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("cannot parse record %q: %v", line, err)
+		}
+		if entry.State != nil && *entry.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+func newFacadeTestInstance(signals ...Signal) *Facade {
+	result := &Facade{}
+	result.ensure()
+	result.Signals = signals
+	return result
+}
+
+type facadeTestSignal struct {
+	typ           Type
+	block         <-chan struct{}
+	initializeErr error
+
+	states []State
+	mutex  sync.Mutex
+}
+
+func (this *facadeTestSignal) SetupConfiguration(common.FlagHolder) {}
+
+func (this *facadeTestSignal) Initialize() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.initializeErr
+}
+
+func (this *facadeTestSignal) setInitializeErr(err error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.initializeErr = err
+}
+
+func (this *facadeTestSignal) Dispose() error {
+	return nil
+}
+
+func (this *facadeTestSignal) Ensure(state State) error {
+	if this.block != nil {
+		<-this.block
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.states = append(this.states, state)
+	return nil
+}
+
+func (this *facadeTestSignal) ensured() []State {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return slices.Clone(this.states)
+}
+
+func (this *facadeTestSignal) Update() error {
+	return nil
+}
+
+func (this *facadeTestSignal) GetType() Type {
+	return this.typ
+}
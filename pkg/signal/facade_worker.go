@@ -0,0 +1,66 @@
+package signal
+
+import "sync"
+
+// facadeWorker ensures the states handed over by Facade.Ensure at a single
+// signal one after another on its own goroutine. Only the latest state which
+// was not picked up yet is kept, so a signal which blocks neither delays the
+// others nor piles up outdated states.
+type facadeWorker struct {
+	signal Signal
+	apply  func(Signal, State)
+
+	pending *State
+	running bool
+	idle    *sync.Cond
+	mutex   sync.Mutex
+}
+
+func newFacadeWorker(s Signal, apply func(Signal, State)) *facadeWorker {
+	result := &facadeWorker{
+		signal: s,
+		apply:  apply,
+	}
+	result.idle = sync.NewCond(&result.mutex)
+	return result
+}
+
+// handOver replaces the pending state with the given one and returns
+// immediately.
+func (this *facadeWorker) handOver(state State) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.pending = &state
+	if !this.running {
+		this.running = true
+		go this.run()
+	}
+}
+
+func (this *facadeWorker) run() {
+	for {
+		this.mutex.Lock()
+		state := this.pending
+		this.pending = nil
+		if state == nil {
+			this.running = false
+			this.idle.Broadcast()
+			this.mutex.Unlock()
+			return
+		}
+		this.mutex.Unlock()
+
+		this.apply(this.signal, *state)
+	}
+}
+
+// await blocks until every state handed over was ensured.
+func (this *facadeWorker) await() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for this.running {
+		this.idle.Wait()
+	}
+}
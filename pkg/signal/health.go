@@ -0,0 +1,26 @@
+package signal
+
+import "time"
+
+// Health describes how successful the latest calls of a Signal were.
+type Health struct {
+	Type    Type `json:"type" yaml:"type"`
+	Healthy bool `json:"healthy" yaml:"healthy"`
+
+	LastSuccess *time.Time `json:"lastSuccess,omitempty" yaml:"lastSuccess,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty" yaml:"lastFailure,omitempty"`
+	// LastError is the error of the latest call, if it failed.
+	LastError string `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+}
+
+func (this *Health) record(err error, at time.Time) {
+	if err != nil {
+		this.Healthy = false
+		this.LastFailure = &at
+		this.LastError = err.Error()
+	} else {
+		this.Healthy = true
+		this.LastSuccess = &at
+		this.LastError = ""
+	}
+}
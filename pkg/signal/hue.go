@@ -1,9 +1,12 @@
 package signal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/amimof/huego"
 	"github.com/blaubaer/talk-indicator/pkg/common"
+	"github.com/blaubaer/talk-indicator/pkg/metrics"
 	log "github.com/echocat/slf4g"
 	"regexp"
 	"sync"
@@ -17,16 +20,36 @@ type Hue struct {
 	Bridge string
 	User   string
 
+	Api                  HueApi
+	CertificateAuthority string
+	Fingerprint          string
+	BridgeId             string
+
 	Kinds HueKinds
 	Name  *regexp.Regexp
 
 	Britness   uint8
 	Hue        uint16
 	Saturation uint8
+	Colors     HueColors
+	Scenes     HueScenes
+
+	OffMode    HueOffMode
+	IdleColour HueColor
+
+	// Unattended lets Initialize fail if pairing is required instead of
+	// waiting for the link button of the bridge to be pressed; for example
+	// while the configuration is reloaded in the background.
+	Unattended bool
 
 	lights      []huego.Light
 	groups      []huego.Group
+	scenes      map[State][]huego.Scene
 	credentials HueCredentials
+	client      hueBridge
+	stopEvents  context.CancelFunc
+	snapshots   HueSnapshots
+	signaled    map[string]bool
 	mutex       sync.Mutex
 }
 
@@ -47,18 +70,25 @@ func (this *Hue) Update() error {
 	if err != nil {
 		return err
 	}
+	scenes, err := this.discoverScenes(bridge)
+	if err != nil {
+		return err
+	}
 
 	this.lights = lights
 	this.groups = groups
+	this.scenes = scenes
 
 	return nil
 }
 
-func (this *Hue) discoverLights(bridge *huego.Bridge) (result []huego.Light, _ error) {
+func (this *Hue) discoverLights(bridge hueBridge) (result []huego.Light, _ error) {
 	if this.Kinds.Has(HueKindLight) {
+		start := time.Now()
 		candidates, err := bridge.GetLights()
+		metrics.Observe(metrics.HueRequestDuration.WithLabelValues("getLights"), start)
 		if err != nil {
-			return nil, fmt.Errorf("cannot discover lights of bridge %s: %w", bridge.Host, err)
+			return nil, fmt.Errorf("cannot discover lights of bridge %v: %w", bridge, err)
 		}
 		for _, candidate := range candidates {
 			if this.Name.MatchString(candidate.Name) {
@@ -72,11 +102,13 @@ func (this *Hue) discoverLights(bridge *huego.Bridge) (result []huego.Light, _ e
 	return
 }
 
-func (this *Hue) discoverGroups(bridge *huego.Bridge) (result []huego.Group, _ error) {
+func (this *Hue) discoverGroups(bridge hueBridge) (result []huego.Group, _ error) {
 	if this.Kinds.Has(HueKindGroup) {
+		start := time.Now()
 		candidates, err := bridge.GetGroups()
+		metrics.Observe(metrics.HueRequestDuration.WithLabelValues("getGroups"), start)
 		if err != nil {
-			return nil, fmt.Errorf("cannot discover groups of bridge %s: %w", bridge.Host, err)
+			return nil, fmt.Errorf("cannot discover groups of bridge %v: %w", bridge, err)
 		}
 		for _, candidate := range candidates {
 			if this.Name.MatchString(candidate.Name) {
@@ -107,7 +139,112 @@ func (this *Hue) Ensure(state State) error {
 	return nil
 }
 
-func (this *Hue) ensureLights(bridge *huego.Bridge, state State) error {
+func (this *Hue) EnsureTargets(state State) (result []TargetResult) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	bridge, err := this.bridge()
+	if err != nil {
+		return []TargetResult{{Type: TypeHue, Target: "bridge", Error: err}}
+	}
+	for i, v := range this.lights {
+		err := this.ensureLight(bridge, state, &v)
+		this.lights[i] = v
+		result = append(result, TargetResult{Type: TypeHue, Target: fmt.Sprintf("light %q#%d", v.Name, v.ID), Error: err})
+	}
+	for i, v := range this.groups {
+		err := this.ensureGroup(bridge, state, &v)
+		this.groups[i] = v
+		result = append(result, TargetResult{Type: TypeHue, Target: fmt.Sprintf("group %q#%d", v.Name, v.ID), Error: err})
+	}
+	if len(result) == 0 {
+		return []TargetResult{{Type: TypeHue, Target: "bridge " + bridge.String(), Error: fmt.Errorf("no lights or groups match %v", this.Name)}}
+	}
+	return result
+}
+
+// Release switches off all lights and groups which are not addressed by
+// successor at the same bridge, too.
+func (this *Hue) Release(successor Signal) error {
+	next, _ := successor.(*Hue)
+	var nextBridge string
+	var retained map[string]bool
+	if next != nil {
+		nextBridge, retained = next.targetKeys()
+	}
+
+	released, sameBridge, err := this.release(nextBridge, retained)
+	if next != nil && len(released) > 0 {
+		if !sameBridge {
+			// Its snapshots belong to other lights with the same IDs.
+			released = nil
+		}
+		next.forgetSnapshots(released)
+	}
+	return err
+}
+
+func (this *Hue) release(nextBridge string, retained map[string]bool) (released []string, sameBridge bool, _ error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	bridge, err := this.bridge()
+	if err != nil {
+		return nil, false, err
+	}
+	if sameBridge = bridge.String() == nextBridge; !sameBridge {
+		retained = nil
+	}
+	var errs []error
+	for i, v := range this.lights {
+		key := hueTargetKey(HueKindLight, v.ID)
+		if retained[key] {
+			continue
+		}
+		errs = append(errs, this.ensureLight(bridge, StateOff, &v))
+		this.lights[i] = v
+		released = append(released, key)
+	}
+	for i, v := range this.groups {
+		key := hueTargetKey(HueKindGroup, v.ID)
+		if retained[key] {
+			continue
+		}
+		errs = append(errs, this.ensureGroup(bridge, StateOff, &v))
+		this.groups[i] = v
+		released = append(released, key)
+		for _, id := range hueMemberIdsOf(&v) {
+			if memberKey := hueTargetKey(HueKindLight, id); !retained[memberKey] {
+				released = append(released, memberKey)
+			}
+		}
+	}
+	return released, sameBridge, errors.Join(errs...)
+}
+
+// targetKeys returns the bridge and the keys of all lights (including the
+// ones of its groups) and groups this instance addresses.
+func (this *Hue) targetKeys() (bridge string, keys map[string]bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.client != nil {
+		bridge = this.client.String()
+	}
+	keys = make(map[string]bool, len(this.lights)+len(this.groups))
+	for _, v := range this.lights {
+		keys[hueTargetKey(HueKindLight, v.ID)] = true
+	}
+	for _, v := range this.groups {
+		keys[hueTargetKey(HueKindGroup, v.ID)] = true
+		for _, id := range hueMemberIdsOf(&v) {
+			keys[hueTargetKey(HueKindLight, id)] = true
+		}
+	}
+	return
+}
+
+func (this *Hue) ensureLights(bridge hueBridge, state State) error {
 	for i, v := range this.lights {
 		if err := this.ensureLight(bridge, state, &v); err != nil {
 			return err
@@ -117,44 +254,107 @@ func (this *Hue) ensureLights(bridge *huego.Bridge, state State) error {
 	return nil
 }
 
-func (this *Hue) ensureState(state State, title string, hueState *huego.State) (*huego.State, error) {
+func (this *Hue) ensureState(state State, key string, title string, hueState *huego.State) (*huego.State, error) {
 	switch state {
-	case StateOn:
-		if !hueState.On || hueState.Bri != this.Britness || hueState.Hue != this.Hue || hueState.Sat != this.Saturation {
-			return &huego.State{
-				On:  true,
-				Bri: this.Britness,
-				Hue: this.Hue,
-				Sat: this.Saturation,
-
-				Ct: 0,
-			}, nil
-		}
 	case StateOff:
-		if hueState.On {
-			return &huego.State{
-				On: false,
-			}, nil
+		switch this.OffMode {
+		case HueOffModeRestore:
+			if v, ok := this.snapshots[key]; ok {
+				result := hueRestoreStateOf(v)
+				return &result, nil
+			}
+			// Without a snapshot (like if it got lost) it is unknown what to
+			// restore, but the signal must not stay forever.
+			if hueState.On && (this.signaled[key] || this.showsSignal(hueState)) {
+				return &huego.State{
+					On: false,
+				}, nil
+			}
+		case HueOffModeIdleColour:
+			bri, hue, sat := this.IdleColour.resolve(hueIdleColor.brightness, hueIdleColor.hue, hueIdleColor.saturation)
+			return this.ensureColour(hueState, bri, hue, sat), nil
+		default:
+			if hueState.On {
+				return &huego.State{
+					On: false,
+				}, nil
+			}
 		}
+	case StateOn, StateMuted, StateSpeaking, StateCamera:
+		bri, hue, sat := this.colourOf(state)
+		return this.ensureColour(hueState, bri, hue, sat), nil
 	default:
 		return nil, fmt.Errorf("cannot ensure hue light state for %s: %v", title, state)
 	}
 	return nil, nil
 }
 
-func (this *Hue) ensureLight(bridge *huego.Bridge, state State, v *huego.Light) error {
-	if newState, err := this.ensureState(state, fmt.Sprintf("light %q#%d", v.Name, v.ID), v.State); err != nil {
+// colourOf returns the colour of the given State, which is not StateOff.
+func (this *Hue) colourOf(state State) (uint8, uint16, uint8) {
+	if state == StateOn {
+		return this.Britness, this.Hue, this.Saturation
+	}
+	return this.Colors.resolve(state)
+}
+
+// showsSignal reports if the given state has the colour of any State other
+// than StateOff.
+func (this *Hue) showsSignal(hueState *huego.State) bool {
+	for _, state := range AllStates {
+		if state == StateOff {
+			continue
+		}
+		if bri, hue, sat := this.colourOf(state); this.ensureColour(hueState, bri, hue, sat) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Hue) ensureColour(hueState *huego.State, bri uint8, hue uint16, sat uint8) *huego.State {
+	if !hueState.On || hueState.Bri != bri || hueState.Hue != hue || hueState.Sat != sat {
+		return &huego.State{
+			On:  true,
+			Bri: bri,
+			Hue: hue,
+			Sat: sat,
+
+			Ct: 0,
+		}
+	}
+	return nil
+}
+
+func (this *Hue) ensureLight(bridge hueBridge, state State, v *huego.Light) error {
+	key := hueTargetKey(HueKindLight, v.ID)
+	if state != StateOff {
+		this.takeSnapshot(key, func() (*huego.State, error) {
+			current, err := bridge.GetLight(v.ID)
+			if err != nil {
+				return nil, err
+			}
+			return current.State, nil
+		}, v.State)
+	}
+	if newState, err := this.ensureState(state, key, fmt.Sprintf("light %q#%d", v.Name, v.ID), v.State); err != nil {
 		return err
 	} else if newState != nil {
-		if _, err := bridge.SetLightState(v.ID, *newState); err != nil {
+		start := time.Now()
+		_, err := bridge.SetLightState(v.ID, *newState)
+		metrics.Observe(metrics.HueRequestDuration.WithLabelValues("setLightState"), start)
+		if err != nil {
 			return fmt.Errorf("cannot switch to hue light state %v for light %q#%d: %w", state, v.Name, v.ID, err)
 		}
 		v.State = &(*newState)
 	}
+	if state == StateOff {
+		this.dropSnapshot(key)
+	}
+	this.markSignaled(key, state != StateOff)
 	return nil
 }
 
-func (this *Hue) ensureGroups(bridge *huego.Bridge, state State) error {
+func (this *Hue) ensureGroups(bridge hueBridge, state State) error {
 	for i, v := range this.groups {
 		if err := this.ensureGroup(bridge, state, &v); err != nil {
 			return err
@@ -164,15 +364,38 @@ func (this *Hue) ensureGroups(bridge *huego.Bridge, state State) error {
 	return nil
 }
 
-func (this *Hue) ensureGroup(bridge *huego.Bridge, state State, v *huego.Group) error {
-	if newState, err := this.ensureState(state, fmt.Sprintf("group %q#%d", v.Name, v.ID), v.State); err != nil {
+func (this *Hue) ensureGroup(bridge hueBridge, state State, v *huego.Group) error {
+	key := hueTargetKey(HueKindGroup, v.ID)
+	// The state of a group only tells what was set last for all of its
+	// lights, therefore the snapshots are taken of each of them.
+	if state != StateOff {
+		this.takeMemberSnapshots(bridge, v)
+	}
+	if scene := this.sceneFor(state, v); scene != nil {
+		if err := this.recallScene(bridge, state, scene, v); err != nil {
+			return err
+		}
+	} else if state == StateOff && this.OffMode == HueOffModeRestore && this.hasMemberSnapshots(v) {
+		if err := this.restoreMembers(bridge, v); err != nil {
+			return err
+		}
+	} else if newState, err := this.ensureState(state, key, fmt.Sprintf("group %q#%d", v.Name, v.ID), v.State); err != nil {
 		return err
 	} else if newState != nil {
-		if _, err := bridge.SetLightState(v.ID, *newState); err != nil {
+		start := time.Now()
+		_, err := bridge.SetGroupState(v.ID, *newState)
+		metrics.Observe(metrics.HueRequestDuration.WithLabelValues("setGroupState"), start)
+		if err != nil {
 			return fmt.Errorf("cannot switch to hue light state %v for group %q#%d: %w", state, v.Name, v.ID, err)
 		}
 		v.State = &(*newState)
 	}
+	if state == StateOff {
+		for _, id := range hueMemberIdsOf(v) {
+			this.dropSnapshot(hueTargetKey(HueKindLight, id))
+		}
+	}
+	this.markSignaled(key, state != StateOff)
 	return nil
 }
 
@@ -183,9 +406,22 @@ func (this *Hue) SetupConfiguration(using common.FlagHolder) {
 	using.Flag("signal.hue.bridge", "Usually the bridge is automatically detected. You can specify an explicit one if they are more than one. This is only required while pairing and will afterwards be ignored.").
 		Envar("TI_SIGNAL_HUE_BRIDGE").
 		StringVar(&this.Bridge)
-	using.Flag("signal.hue.user", "Usually this is set while pairing and will then be persisted. If this set this will be used and not be persisted.").
+	common.Secret(using.Flag("signal.hue.user", "Usually this is set while pairing and will then be persisted. If this set this will be used and not be persisted.")).
 		Envar("TI_SIGNAL_HUE_USER").
 		StringVar(&this.User)
+	using.Flag("signal.hue.api", "API of the bridge to use. v1: the deprecated REST API via HTTP; changes made outside of this application are only noticed with each refresh. v2: the CLIP API v2 via HTTPS (including the pairing), which requires signal.hue.ca or signal.hue.fingerprint to validate the certificate of the bridge; changes are received immediately via its event stream.").
+		Envar("TI_SIGNAL_HUE_API").
+		Default(this.Api.String()).
+		SetValue(&this.Api)
+	using.Flag("signal.hue.ca", "PEM file containing the certificate authority the certificate of the bridge has to be signed by (API v2 only). For real bridges this is the root CA of Signify.").
+		Envar("TI_SIGNAL_HUE_CA").
+		StringVar(&this.CertificateAuthority)
+	using.Flag("signal.hue.fingerprint", "SHA-256 fingerprint (hex, optionally separated by colons) the certificate of the bridge has to match (API v2 only).").
+		Envar("TI_SIGNAL_HUE_FINGERPRINT").
+		StringVar(&this.Fingerprint)
+	using.Flag("signal.hue.bridgeId", "ID of the bridge (like 001788fffe123456) which has to be the common name of its certificate (API v2 only). If empty every certificate accepted by signal.hue.ca or signal.hue.fingerprint is fine.").
+		Envar("TI_SIGNAL_HUE_BRIDGE_ID").
+		StringVar(&this.BridgeId)
 	using.Flag("signal.hue.name", "Name as regex of the lights/groups which should be handled by this app.").
 		Envar("TI_SIGNAL_HUE_NAME").
 		Default("^OnAir").
@@ -206,6 +442,22 @@ func (this *Hue) SetupConfiguration(using common.FlagHolder) {
 		Envar("TI_SIGNAL_HUE_SATURATION").
 		Default("254").
 		Uint8Var(&this.Saturation)
+
+	if this.Colors == nil {
+		this.Colors = HueColors{}
+	}
+	this.Colors.SetupConfiguration(using)
+
+	if this.Scenes == nil {
+		this.Scenes = HueScenes{}
+	}
+	this.Scenes.SetupConfiguration(using)
+
+	using.Flag("signal.hue.offMode", "What happens with the lights on state off. off: switch them off. restore: restore the state they had before they were switched on (the snapshot is persisted to survive restarts); without a snapshot they are switched off if they still show a signal. idle-colour: switch them to the idle colour.").
+		Envar("TI_SIGNAL_HUE_OFF_MODE").
+		Default(this.OffMode.String()).
+		SetValue(&this.OffMode)
+	this.IdleColour.setupConfiguration(using, "idle", "while the state is off and signal.hue.offMode is idle-colour. Defaults to "+hueIdleColor.name, hueIdleColor)
 }
 
 func (this *Hue) Initialize() error {
@@ -215,19 +467,40 @@ func (this *Hue) Initialize() error {
 	}
 	this.credentials = credentials
 
+	client, err := this.bridgeOf(credentials)
+	if err != nil {
+		return err
+	}
+	this.client = client
+
+	snapshots, err := this.readSnapshots()
+	if err != nil {
+		log.WithError(err).
+			Warn("Cannot read snapshots. Lights which are on currently will not be restored.")
+		snapshots = HueSnapshots{}
+	}
+	this.snapshots = snapshots
+
 	if err := this.Update(); err != nil {
 		return err
 	}
 
+	if v2, ok := client.(*hueV2Client); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		this.stopEvents = cancel
+		go v2.watch(ctx, func(v hueV2Resource) {
+			this.onEvent(v2, v)
+		})
+	}
+
 	return nil
 }
 
-func (this *Hue) bridge() (*huego.Bridge, error) {
-	credentials := this.credentials
-	if credentials.IsZero() {
+func (this *Hue) bridge() (hueBridge, error) {
+	if this.credentials.IsZero() || this.client == nil {
 		return nil, fmt.Errorf("not paired with hue bridge")
 	}
-	return credentials.Bridge(), nil
+	return this.client, nil
 }
 
 func (this *Hue) resolveCredentials() (HueCredentials, error) {
@@ -278,10 +551,23 @@ func (this *Hue) pair() (HueCredentials, error) {
 	if err != nil {
 		return HueCredentials{}, err
 	}
+	if this.Unattended {
+		return HueCredentials{}, fmt.Errorf("pairing with hue bridge %s required, which needs its link button to be pressed; use the command 'hue pair' first", bridge.Host)
+	}
+	createUser := bridge.CreateUser
+	if this.Api == HueApiV2 {
+		// The application key is obtained via HTTPS, too; the certificate of
+		// the bridge is validated like for every other request.
+		client, err := this.newV2Client(HueCredentials{Host: bridge.Host})
+		if err != nil {
+			return HueCredentials{}, err
+		}
+		createUser = client.createUser
+	}
 
 	for {
 		log.Info("Wait for hue link button been pressed...")
-		user, err := bridge.CreateUser(appName)
+		user, err := createUser(appName)
 		if apiErr, ok := err.(*huego.APIError); ok && apiErr.Type == 101 && apiErr.Description == "link button not pressed" {
 			time.Sleep(1 * time.Second)
 			continue
@@ -306,6 +592,10 @@ func (this *Hue) pair() (HueCredentials, error) {
 }
 
 func (this *Hue) Dispose() error {
+	if cancel := this.stopEvents; cancel != nil {
+		this.stopEvents = nil
+		cancel()
+	}
 	return nil
 }
 
@@ -0,0 +1,192 @@
+package signal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/amimof/huego"
+	log "github.com/echocat/slf4g"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HueEntry describes a light or a group of the hue bridge.
+type HueEntry struct {
+	Kind HueKind `json:"kind" yaml:"kind"`
+	ID   int     `json:"id" yaml:"id"`
+	Name string  `json:"name" yaml:"name"`
+	Type string  `json:"type" yaml:"type"`
+	On   bool    `json:"on" yaml:"on"`
+	// Reachable is only known for lights.
+	Reachable *bool `json:"reachable,omitempty" yaml:"reachable,omitempty"`
+	// Matches is true if this entry is handled by the signal, because it
+	// matches the configured name and kind.
+	Matches bool `json:"matches" yaml:"matches"`
+}
+
+// PairBridge pairs with the hue bridge (waiting for its link button being
+// pressed) and persists the resulting credentials, regardless of any already
+// existing ones. Using the API v2 the pairing is done via HTTPS, validating
+// the certificate of the bridge.
+func (this *Hue) PairBridge() (HueCredentials, error) {
+	return this.pair()
+}
+
+// UnpairBridge removes the persisted credentials and tries to remove the
+// user of them from the bridge, too. Newer bridges do not allow the latter
+// anymore; then the user has to be removed using the hue app or website.
+func (this *Hue) UnpairBridge() (HueCredentials, error) {
+	credentials, err := this.readCredentials()
+	if err != nil {
+		return HueCredentials{}, err
+	}
+	if credentials.HasContent() {
+		if err := credentials.Bridge().DeleteUser(credentials.User); err != nil {
+			log.WithError(err).
+				With("bridge", credentials.Host).
+				Warn("Cannot remove user from bridge; it has to be removed using the hue app or website.")
+		}
+	}
+	if err := this.deleteCredentials(); err != nil {
+		return HueCredentials{}, err
+	}
+	return credentials, nil
+}
+
+// Entries returns all entries of the given kind of the bridge, regardless of
+// whether they are matching or not.
+func (this *Hue) Entries(kind HueKind) ([]HueEntry, error) {
+	bridge, err := this.pairedBridge()
+	if err != nil {
+		return nil, err
+	}
+	return this.entries(bridge, kind)
+}
+
+func (this *Hue) entries(bridge hueBridge, kind HueKind) ([]HueEntry, error) {
+	var result []HueEntry
+	switch kind {
+	case HueKindLight:
+		lights, err := bridge.GetLights()
+		if err != nil {
+			return nil, fmt.Errorf("cannot discover lights of bridge %v: %w", bridge, err)
+		}
+		for _, v := range lights {
+			entry := HueEntry{
+				Kind:    kind,
+				ID:      v.ID,
+				Name:    v.Name,
+				Type:    v.Type,
+				Matches: this.Kinds.Has(kind) && this.Name.MatchString(v.Name),
+			}
+			if v.State != nil {
+				reachable := v.State.Reachable
+				entry.On, entry.Reachable = v.State.On, &reachable
+			}
+			result = append(result, entry)
+		}
+	case HueKindGroup:
+		groups, err := bridge.GetGroups()
+		if err != nil {
+			return nil, fmt.Errorf("cannot discover groups of bridge %v: %w", bridge, err)
+		}
+		for _, v := range groups {
+			entry := HueEntry{
+				Kind:    kind,
+				ID:      v.ID,
+				Name:    v.Name,
+				Type:    v.Type,
+				Matches: this.Kinds.Has(kind) && this.Name.MatchString(v.Name),
+			}
+			if v.GroupState != nil {
+				entry.On = v.GroupState.AnyOn
+			}
+			result = append(result, entry)
+		}
+	default:
+		return nil, fmt.Errorf("illegal-signal-hue-kind: %v", kind)
+	}
+	return result, nil
+}
+
+// Identify lets all lights and groups blink (using the alert effect) for
+// the given duration which have the given name (case-insensitive) or ID.
+// Lights and groups which were off are switched off again afterwards.
+func (this *Hue) Identify(nameOrId string, duration time.Duration) ([]HueEntry, error) {
+	bridge, err := this.pairedBridge()
+	if err != nil {
+		return nil, err
+	}
+	return this.identify(bridge, nameOrId, duration)
+}
+
+func (this *Hue) identify(bridge hueBridge, nameOrId string, duration time.Duration) (result []HueEntry, rErr error) {
+	var switchedOn []HueEntry
+	defer func() {
+		if len(switchedOn) == 0 {
+			return
+		}
+		if rErr == nil {
+			time.Sleep(duration)
+		}
+		for _, entry := range switchedOn {
+			if err := this.setEntryState(bridge, entry, huego.State{On: false}); err != nil {
+				rErr = errors.Join(rErr, fmt.Errorf("cannot switch %v %q#%d off again: %w", entry.Kind, entry.Name, entry.ID, err))
+			}
+		}
+	}()
+
+	for _, kind := range AllHueKinds {
+		entries, err := this.entries(bridge, kind)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !strings.EqualFold(entry.Name, nameOrId) && strconv.Itoa(entry.ID) != nameOrId {
+				continue
+			}
+			// On is always sent (huego.State does not omit it) and a light
+			// cannot blink while it is off anyway.
+			if err := this.setEntryState(bridge, entry, huego.State{On: true, Alert: "lselect"}); err != nil {
+				return nil, fmt.Errorf("cannot identify %v %q#%d: %w", entry.Kind, entry.Name, entry.ID, err)
+			}
+			if !entry.On {
+				switchedOn = append(switchedOn, entry)
+			}
+			result = append(result, entry)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no light or group with name or ID %q", nameOrId)
+	}
+	return result, nil
+}
+
+func (this *Hue) setEntryState(bridge hueBridge, entry HueEntry, state huego.State) (err error) {
+	if entry.Kind == HueKindGroup {
+		_, err = bridge.SetGroupState(entry.ID, state)
+	} else {
+		_, err = bridge.SetLightState(entry.ID, state)
+	}
+	return
+}
+
+// pairedBridge returns the bridge using the configured or persisted
+// credentials. Contrary to Initialize() it never pairs implicitly.
+func (this *Hue) pairedBridge() (hueBridge, error) {
+	if this.User != "" {
+		credentials, err := this.resolveCredentials()
+		if err != nil {
+			return nil, err
+		}
+		return this.bridgeOf(credentials)
+	}
+	credentials, err := this.readCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if credentials.IsZero() {
+		return nil, fmt.Errorf("not paired with hue bridge; pair first using: hue pair")
+	}
+	return this.bridgeOf(credentials)
+}
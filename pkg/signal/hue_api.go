@@ -0,0 +1,40 @@
+package signal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HueApi defines which API of the hue bridge is used.
+type HueApi uint8
+
+const (
+	// HueApiV1 is the deprecated REST API via plain HTTP.
+	HueApiV1 = HueApi(0)
+	// HueApiV2 is the CLIP API v2 via HTTPS including its event stream.
+	HueApiV2 = HueApi(1)
+)
+
+func (this *HueApi) Set(plain string) error {
+	switch strings.TrimSpace(strings.ToLower(plain)) {
+	case "v1", "1":
+		*this = HueApiV1
+		return nil
+	case "v2", "2", "clip", "clipv2":
+		*this = HueApiV2
+		return nil
+	default:
+		return fmt.Errorf("illegal-signal-hue-api: %s", plain)
+	}
+}
+
+func (this HueApi) String() string {
+	switch this {
+	case HueApiV1:
+		return "v1"
+	case HueApiV2:
+		return "v2"
+	default:
+		return fmt.Sprintf("illegal-signal-hue-api-%d", this)
+	}
+}
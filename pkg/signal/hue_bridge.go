@@ -0,0 +1,91 @@
+package signal
+
+import (
+	"github.com/amimof/huego"
+	"sync"
+)
+
+// hueBridge is everything Hue requires from a bridge. The states, IDs, ... are
+// always expressed in terms of the v1 API, regardless of which API is used.
+type hueBridge interface {
+	GetLights() ([]huego.Light, error)
+	GetLight(id int) (*huego.Light, error)
+	SetLightState(id int, state huego.State) (*huego.Response, error)
+
+	GetGroups() ([]huego.Group, error)
+	SetGroupState(id int, state huego.State) (*huego.Response, error)
+
+	GetScenes() ([]huego.Scene, error)
+	RecallScene(id string, groupId int) (*huego.Response, error)
+
+	String() string
+}
+
+// hueV1Bridge uses the v1 REST API of the bridge via huego. This API does
+// not tell which scene is active; therefore the scene recalled last on a group
+// is reported as its Scene until anything else is set on it or it is off.
+type hueV1Bridge struct {
+	*huego.Bridge
+
+	recalled map[int]string
+	mutex    sync.Mutex
+}
+
+func newHueV1Bridge(credentials HueCredentials) *hueV1Bridge {
+	return &hueV1Bridge{
+		Bridge:   credentials.Bridge(),
+		recalled: map[int]string{},
+	}
+}
+
+func (this *hueV1Bridge) GetGroups() ([]huego.Group, error) {
+	result, err := this.Bridge.GetGroups()
+	if err != nil {
+		return nil, err
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, v := range result {
+		scene, ok := this.recalled[v.ID]
+		if !ok || v.State == nil {
+			continue
+		}
+		if v.State.On {
+			v.State.Scene = scene
+		} else {
+			delete(this.recalled, v.ID)
+		}
+	}
+	return result, nil
+}
+
+func (this *hueV1Bridge) SetGroupState(id int, state huego.State) (*huego.Response, error) {
+	this.mutex.Lock()
+	delete(this.recalled, id)
+	this.mutex.Unlock()
+	return this.Bridge.SetGroupState(id, state)
+}
+
+func (this *hueV1Bridge) RecallScene(id string, groupId int) (*huego.Response, error) {
+	result, err := this.Bridge.RecallScene(id, groupId)
+	if err != nil {
+		return nil, err
+	}
+	this.mutex.Lock()
+	this.recalled[groupId] = id
+	this.mutex.Unlock()
+	return result, nil
+}
+
+func (this *hueV1Bridge) String() string {
+	return this.Host
+}
+
+// bridgeOf creates the bridge for the given credentials using the configured
+// API.
+func (this *Hue) bridgeOf(credentials HueCredentials) (hueBridge, error) {
+	if this.Api == HueApiV2 {
+		return this.newV2Client(credentials)
+	}
+	return newHueV1Bridge(credentials), nil
+}
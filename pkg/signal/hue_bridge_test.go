@@ -0,0 +1,74 @@
+package signal
+
+import (
+	"encoding/json"
+	"github.com/amimof/huego"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHueV1Bridge_reportsRecalledScene(t *testing.T) {
+	server, setOn := newHueV1TestServer(t)
+	bridge := newHueV1Bridge(HueCredentials{Host: strings.TrimPrefix(server.URL, "http://"), User: "test"})
+
+	if _, err := bridge.RecallScene("AbCdEf", 1); err != nil {
+		t.Fatalf("RecallScene() failed: %v", err)
+	}
+	hueV1TestExpectScene(t, bridge, "AbCdEf")
+
+	if _, err := bridge.SetGroupState(1, huego.State{On: true}); err != nil {
+		t.Fatalf("SetGroupState() failed: %v", err)
+	}
+	hueV1TestExpectScene(t, bridge, "")
+
+	if _, err := bridge.RecallScene("AbCdEf", 1); err != nil {
+		t.Fatalf("RecallScene() failed: %v", err)
+	}
+	// Switched off outside of this application.
+	setOn(false)
+	hueV1TestExpectScene(t, bridge, "")
+	setOn(true)
+	hueV1TestExpectScene(t, bridge, "")
+}
+
+func hueV1TestExpectScene(t *testing.T, bridge hueBridge, expected string) {
+	t.Helper()
+	groups, err := bridge.GetGroups()
+	if err != nil {
+		t.Fatalf("GetGroups() failed: %v", err)
+	}
+	if len(groups) != 1 || groups[0].State.Scene != expected {
+		t.Errorf("GetGroups() = %+v; want scene %q", groups, expected)
+	}
+}
+
+// newHueV1TestServer serves group 1 via the v1 API. The returned function
+// switches it on or off.
+func newHueV1TestServer(t *testing.T) (*httptest.Server, func(bool)) {
+	t.Helper()
+	var mutex sync.Mutex
+	on := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/test/groups":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"1": map[string]any{"name": "Office", "lights": []string{"1"}, "type": "Room", "action": map[string]any{"on": on}},
+			})
+		case r.Method == http.MethodPut && r.URL.Path == "/api/test/groups/1/action":
+			_, _ = w.Write([]byte(`[{"success":{"/groups/1/action/on":true}}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func(v bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		on = v
+	}
+}
@@ -0,0 +1,119 @@
+package signal
+
+import (
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"strconv"
+	"strings"
+)
+
+// HueColor holds the colour of a light for a specific State. Each component
+// which is nil falls back to the default of this State.
+type HueColor struct {
+	Brightness *uint8
+	Hue        *uint16
+	Saturation *uint8
+}
+
+func (this *HueColor) resolve(fallbackBrightness uint8, fallbackHue uint16, fallbackSaturation uint8) (uint8, uint16, uint8) {
+	if this == nil {
+		return fallbackBrightness, fallbackHue, fallbackSaturation
+	}
+	if v := this.Brightness; v != nil {
+		fallbackBrightness = *v
+	}
+	if v := this.Hue; v != nil {
+		fallbackHue = *v
+	}
+	if v := this.Saturation; v != nil {
+		fallbackSaturation = *v
+	}
+	return fallbackBrightness, fallbackHue, fallbackSaturation
+}
+
+// hueDefaultColor is the colour of a State other than StateOn if nothing is
+// configured, so each State can be told apart out of the box.
+type hueDefaultColor struct {
+	name       string
+	brightness uint8
+	hue        uint16
+	saturation uint8
+}
+
+var hueDefaultColors = map[State]hueDefaultColor{
+	StateMuted:    {"a dimmed orange", 150, 6000, 254},
+	StateSpeaking: {"magenta", 254, 56100, 254},
+	StateCamera:   {"blue", 254, 46920, 254},
+}
+
+// hueIdleColor is the colour of HueOffModeIdleColour if nothing is
+// configured.
+var hueIdleColor = hueDefaultColor{"a warm white", 254, 8418, 140}
+
+type HueColors map[State]*HueColor
+
+// resolve returns the colour for the given State, which is neither StateOff
+// nor StateOn.
+func (this HueColors) resolve(state State) (uint8, uint16, uint8) {
+	def := hueDefaultColors[state]
+	return this[state].resolve(def.brightness, def.hue, def.saturation)
+}
+
+func (this HueColors) SetupConfiguration(using common.FlagHolder) {
+	for _, state := range AllStates {
+		if state == StateOff || state == StateOn {
+			continue
+		}
+		v, ok := this[state]
+		if !ok {
+			v = &HueColor{}
+			this[state] = v
+		}
+		v.SetupConfiguration(using, state)
+	}
+}
+
+func (this *HueColor) SetupConfiguration(using common.FlagHolder, state State) {
+	def := hueDefaultColors[state]
+	this.setupConfiguration(using, state.String(), fmt.Sprintf("while the state is %v. Defaults to %s", state, def.name), def)
+}
+
+// setupConfiguration registers the flags signal.hue.<name>.* where each help
+// ends with while. The components of def are their defaults, so the
+// effective colour is visible in the help and in the dumped configuration.
+func (this *HueColor) setupConfiguration(using common.FlagHolder, name string, while string, def hueDefaultColor) {
+	using.Flag(fmt.Sprintf("signal.hue.%s.brightness", name), fmt.Sprintf("The brightness value to set the light to %s.", while)).
+		Envar(fmt.Sprintf("TI_SIGNAL_HUE_%s_BRIGHTNESS", strings.ToUpper(name))).
+		Default(strconv.FormatUint(uint64(def.brightness), 10)).
+		SetValue(&hueColorComponent[uint8]{&this.Brightness, 8})
+	using.Flag(fmt.Sprintf("signal.hue.%s.hue", name), fmt.Sprintf("The hue value to set the light to %s.", while)).
+		Envar(fmt.Sprintf("TI_SIGNAL_HUE_%s_HUE", strings.ToUpper(name))).
+		Default(strconv.FormatUint(uint64(def.hue), 10)).
+		SetValue(&hueColorComponent[uint16]{&this.Hue, 16})
+	using.Flag(fmt.Sprintf("signal.hue.%s.saturation", name), fmt.Sprintf("Saturation of the light %s.", while)).
+		Envar(fmt.Sprintf("TI_SIGNAL_HUE_%s_SATURATION", strings.ToUpper(name))).
+		Default(strconv.FormatUint(uint64(def.saturation), 10)).
+		SetValue(&hueColorComponent[uint8]{&this.Saturation, 8})
+}
+
+type hueColorComponent[T uint8 | uint16] struct {
+	target **T
+	bits   int
+}
+
+func (this *hueColorComponent[T]) Set(plain string) error {
+	v, err := strconv.ParseUint(plain, 10, this.bits)
+	if err != nil {
+		return fmt.Errorf("illegal-signal-hue-color-component: %s", plain)
+	}
+	buf := T(v)
+	*this.target = &buf
+	return nil
+}
+
+func (this *hueColorComponent[T]) String() string {
+	if v := *this.target; v != nil {
+		return strconv.FormatUint(uint64(*v), 10)
+	}
+	return ""
+}
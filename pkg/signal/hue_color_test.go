@@ -0,0 +1,64 @@
+package signal
+
+import (
+	"github.com/alecthomas/kingpin/v2"
+	"testing"
+)
+
+func TestHueColors_resolve(t *testing.T) {
+	brightness := uint8(42)
+	configured := HueColors{
+		StateMuted: &HueColor{Brightness: &brightness},
+	}
+
+	cases := []struct {
+		state      State
+		colors     HueColors
+		brightness uint8
+		hue        uint16
+		saturation uint8
+	}{
+		{StateMuted, HueColors{}, 150, 6000, 254},
+		{StateSpeaking, HueColors{}, 254, 56100, 254},
+		{StateCamera, HueColors{}, 254, 46920, 254},
+		{StateMuted, configured, 42, 6000, 254},
+	}
+	for _, c := range cases {
+		bri, hue, sat := c.colors.resolve(c.state)
+		if bri != c.brightness || hue != c.hue || sat != c.saturation {
+			t.Errorf("resolve(%v) = (%d, %d, %d); want (%d, %d, %d)", c.state, bri, hue, sat, c.brightness, c.hue, c.saturation)
+		}
+	}
+
+	seen := map[uint16]State{}
+	for state, def := range hueDefaultColors {
+		if other, ok := seen[def.hue]; ok {
+			t.Errorf("default hue of %v equals the one of %v", state, other)
+		}
+		seen[def.hue] = state
+	}
+}
+
+func TestHueColors_SetupConfiguration_registersDefaults(t *testing.T) {
+	colors := HueColors{}
+	app := kingpin.New("test", "")
+	colors.SetupConfiguration(app)
+	if _, err := app.Parse([]string{"--signal.hue.speaking.hue=100"}); err != nil {
+		t.Fatalf("cannot parse arguments: %v", err)
+	}
+
+	// The defaults are visible as values of the flags.
+	for name, expected := range map[string]string{
+		"signal.hue.muted.brightness":  "150",
+		"signal.hue.muted.hue":         "6000",
+		"signal.hue.speaking.hue":      "100",
+		"signal.hue.camera.saturation": "254",
+	} {
+		if actual := app.GetFlag(name).Model().Value.String(); actual != expected {
+			t.Errorf("%s = %q; want %q", name, actual, expected)
+		}
+	}
+	if bri, hue, sat := colors.resolve(StateSpeaking); bri != 254 || hue != 100 || sat != 254 {
+		t.Errorf("resolve(speaking) = (%d, %d, %d); want (254, 100, 254)", bri, hue, sat)
+	}
+}
@@ -43,6 +43,14 @@ func (this HueKind) String() string {
 	}
 }
 
+func (this HueKind) MarshalText() ([]byte, error) {
+	return []byte(this.String()), nil
+}
+
+func (this *HueKind) UnmarshalText(text []byte) error {
+	return this.Set(string(text))
+}
+
 type HueKinds []HueKind
 
 func (this *HueKinds) Set(plain string) error {
@@ -0,0 +1,58 @@
+package signal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HueOffMode defines what happens with the lights and groups on StateOff.
+type HueOffMode uint8
+
+const (
+	// HueOffModeOff switches them off.
+	HueOffModeOff = HueOffMode(0)
+	// HueOffModeRestore restores the state they had before they were switched
+	// to any other state. If there is no such state (like if it got lost) they
+	// are switched off if they still show any other state, otherwise they are
+	// left untouched.
+	HueOffModeRestore = HueOffMode(1)
+	// HueOffModeIdleColour switches them to the idle colour.
+	HueOffModeIdleColour = HueOffMode(2)
+)
+
+var (
+	AllHueOffModes = []HueOffMode{
+		HueOffModeOff,
+		HueOffModeRestore,
+		HueOffModeIdleColour,
+	}
+)
+
+func (this *HueOffMode) Set(plain string) error {
+	switch strings.TrimSpace(strings.ToLower(plain)) {
+	case "off":
+		*this = HueOffModeOff
+		return nil
+	case "restore":
+		*this = HueOffModeRestore
+		return nil
+	case "idle-colour", "idle-color", "idle":
+		*this = HueOffModeIdleColour
+		return nil
+	default:
+		return fmt.Errorf("illegal-signal-hue-off-mode: %s", plain)
+	}
+}
+
+func (this HueOffMode) String() string {
+	switch this {
+	case HueOffModeOff:
+		return "off"
+	case HueOffModeRestore:
+		return "restore"
+	case HueOffModeIdleColour:
+		return "idle-colour"
+	default:
+		return fmt.Sprintf("illegal-signal-hue-off-mode-%d", this)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+
+package signal
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/echocat/slf4g"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+func (this *Hue) credentialsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve user configuration directory for HUE credentials: %w", err)
+	}
+	return filepath.Join(dir, "talk-indicator", "hue-credentials.json"), nil
+}
+
+func (this *Hue) readCredentials() (HueCredentials, error) {
+	file, err := this.credentialsFile()
+	if err != nil {
+		return HueCredentials{}, err
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return HueCredentials{}, nil
+	}
+	if err != nil {
+		return HueCredentials{}, fmt.Errorf("cannot retrieve HUE crendtials from %s: %w", file, err)
+	}
+	var result HueCredentials
+	if err := result.UnmarshalBinary(b); err != nil {
+		log.WithError(err).
+			With("file", file).
+			Error("Cannot unmarshal credentials from file. Assume it was empty.")
+	}
+
+	return result, nil
+}
+
+func (this *Hue) storeCredentials(v HueCredentials) error {
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("cannot marshal HUE crendtials to JSON: %w", err)
+	}
+
+	file, err := this.credentialsFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("cannot create directory for HUE crendtials %s: %w", file, err)
+	}
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		return fmt.Errorf("cannot store HUE crendtials to %s: %w", file, err)
+	}
+
+	return nil
+}
+
+func (this *Hue) deleteCredentials() error {
+	file, err := this.credentialsFile()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot delete HUE crendtials %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package signal
+
+import (
+	"fmt"
+	"github.com/amimof/huego"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"github.com/blaubaer/talk-indicator/pkg/metrics"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HueScenes holds the name or ID of the scene which should be recalled on the
+// groups for a specific State. If empty the colour is used instead.
+type HueScenes map[State]*string
+
+func (this HueScenes) SetupConfiguration(using common.FlagHolder) {
+	for _, state := range AllStates {
+		v, ok := this[state]
+		if !ok {
+			v = new(string)
+			this[state] = v
+		}
+		instead := "the colour"
+		if state == StateOff {
+			instead = "signal.hue.offMode"
+		}
+		using.Flag(fmt.Sprintf("signal.hue.%v.scene", state), fmt.Sprintf("Name or ID of the scene to recall on the groups while the state is %v. If set it is used instead of %s on every group with a scene of this name (or a scene of some of its lights). Lights which are not part of any group are not affected.", state, instead)).
+			Envar(fmt.Sprintf("TI_SIGNAL_HUE_%s_SCENE", strings.ToUpper(state.String()))).
+			StringVar(v)
+	}
+}
+
+func (this HueScenes) isEmpty() bool {
+	for _, v := range this {
+		if v != nil && *v != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// discoverScenes resolves all configured scenes by their ID or name. Names
+// might be used by scenes of different groups; therefore all candidates are
+// returned and the one which fits is selected by sceneFor().
+func (this *Hue) discoverScenes(bridge hueBridge) (map[State][]huego.Scene, error) {
+	if this.Scenes.isEmpty() || !this.Kinds.Has(HueKindGroup) {
+		return nil, nil
+	}
+
+	start := time.Now()
+	candidates, err := bridge.GetScenes()
+	metrics.Observe(metrics.HueRequestDuration.WithLabelValues("getScenes"), start)
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover scenes of bridge %v: %w", bridge, err)
+	}
+
+	result := map[State][]huego.Scene{}
+	for state, v := range this.Scenes {
+		if v == nil || *v == "" {
+			continue
+		}
+		var byName []huego.Scene
+		for _, candidate := range candidates {
+			if candidate.ID == *v {
+				byName = []huego.Scene{candidate}
+				break
+			}
+			if strings.EqualFold(candidate.Name, *v) {
+				byName = append(byName, candidate)
+			}
+		}
+		if len(byName) == 0 {
+			return nil, fmt.Errorf("cannot resolve scene %q for state %v at bridge %v: no scene with this name or ID", *v, state, bridge)
+		}
+		result[state] = byName
+	}
+	return result, nil
+}
+
+// sceneFor returns the scene to recall on the given group for the given state
+// or nil if there is none. Only scenes of this group or scenes of lights
+// which are part of it are accepted, as any other one would change lights
+// outside of this group.
+func (this *Hue) sceneFor(state State, group *huego.Group) *huego.Scene {
+	candidates := this.scenes[state]
+	id := strconv.Itoa(group.ID)
+	for i, candidate := range candidates {
+		if candidate.Group == id {
+			return &candidates[i]
+		}
+	}
+	for i, candidate := range candidates {
+		if candidate.Group == "" && slices.ContainsFunc(candidate.Lights, func(light string) bool {
+			return slices.Contains(group.Lights, light)
+		}) {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+func (this *Hue) recallScene(bridge hueBridge, state State, scene *huego.Scene, v *huego.Group) error {
+	if v.State.On && v.State.Scene == scene.ID {
+		return nil
+	}
+	start := time.Now()
+	_, err := bridge.RecallScene(scene.ID, v.ID)
+	metrics.Observe(metrics.HueRequestDuration.WithLabelValues("recallScene"), start)
+	if err != nil {
+		return fmt.Errorf("cannot recall hue scene %q#%s for state %v on group %q#%d: %w", scene.Name, scene.ID, state, v.Name, v.ID, err)
+	}
+	v.State = &huego.State{
+		On:    true,
+		Scene: scene.ID,
+	}
+	return nil
+}
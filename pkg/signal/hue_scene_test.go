@@ -0,0 +1,65 @@
+package signal
+
+import (
+	"github.com/amimof/huego"
+	"testing"
+)
+
+func TestHue_sceneFor(t *testing.T) {
+	instance := &Hue{scenes: map[State][]huego.Scene{
+		StateOn: {
+			{ID: "kitchen", Name: "Focus", Type: "GroupScene", Group: "2"},
+			{ID: "office", Name: "Focus", Type: "GroupScene", Group: "1"},
+			{ID: "desk", Name: "Focus", Type: "LightScene", Lights: []string{"5", "6"}},
+		},
+	}}
+
+	cases := []struct {
+		name     string
+		group    huego.Group
+		expected string
+	}{
+		{"scene of group", huego.Group{ID: 1, Lights: []string{"1", "6"}}, "office"},
+		{"scene of other group", huego.Group{ID: 2}, "kitchen"},
+		{"scene of some lights", huego.Group{ID: 3, Lights: []string{"6", "7"}}, "desk"},
+		{"no scene", huego.Group{ID: 4, Lights: []string{"7"}}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := instance.sceneFor(StateOn, &c.group)
+			if c.expected == "" {
+				if actual != nil {
+					t.Errorf("sceneFor() = %+v; want nil", actual)
+				}
+			} else if actual == nil || actual.ID != c.expected {
+				t.Errorf("sceneFor() = %+v; want %s", actual, c.expected)
+			}
+		})
+	}
+
+	if actual := instance.sceneFor(StateMuted, &huego.Group{ID: 1}); actual != nil {
+		t.Errorf("sceneFor(muted) = %+v; want nil", actual)
+	}
+}
+
+func TestHue_onEvent_scene(t *testing.T) {
+	client := &hueV2Client{
+		scenes: map[string]huego.Scene{
+			"6a1f": {ID: "AbCdEf", Group: "1"},
+		},
+		ids:  map[string]string{},
+		sent: map[string]huego.State{},
+	}
+	instance := &Hue{groups: []huego.Group{{ID: 1, State: &huego.State{On: true}}}}
+	handle := func(v hueV2Resource) { instance.onEvent(client, v) }
+
+	client.dispatch(`[{"type":"update","data":[{"id":"6a1f","type":"scene","status":{"active":"static"}}]}]`, handle)
+	if actual := instance.groups[0].State.Scene; actual != "AbCdEf" {
+		t.Errorf("scene = %q after activation; want AbCdEf", actual)
+	}
+
+	client.dispatch(`[{"type":"update","data":[{"id":"6a1f","type":"scene","status":{"active":"inactive"}}]}]`, handle)
+	if actual := instance.groups[0].State.Scene; actual != "" {
+		t.Errorf("scene = %q after deactivation; want none", actual)
+	}
+}
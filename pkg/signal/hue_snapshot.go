@@ -0,0 +1,242 @@
+package signal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/amimof/huego"
+	"github.com/blaubaer/talk-indicator/pkg/metrics"
+	log "github.com/echocat/slf4g"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// HueSnapshots holds the states lights had before they (or a group they are
+// part of) were switched to any other state than StateOff, by their target
+// key (like light/1). They are persisted to survive restarts.
+type HueSnapshots map[string]huego.State
+
+func hueTargetKey(kind HueKind, id int) string {
+	return fmt.Sprintf("%v/%d", kind, id)
+}
+
+// hueSnapshotOf reduces the given state to what is required to restore it.
+func hueSnapshotOf(v huego.State) huego.State {
+	return huego.State{
+		On:        v.On,
+		Bri:       v.Bri,
+		Hue:       v.Hue,
+		Sat:       v.Sat,
+		Xy:        v.Xy,
+		Ct:        v.Ct,
+		ColorMode: v.ColorMode,
+	}
+}
+
+// hueRestoreStateOf returns the state which has to be sent to restore the
+// given snapshot. Only the colour of the mode the light was in is restored.
+func hueRestoreStateOf(v huego.State) huego.State {
+	if !v.On {
+		return huego.State{On: false}
+	}
+	result := huego.State{On: true, Bri: v.Bri}
+	switch v.ColorMode {
+	case "ct":
+		result.Ct = v.Ct
+	case "xy":
+		result.Xy = v.Xy
+	case "hs":
+		// Zero values are not sent at all; 65535 is the same red as 0 and 1
+		// is (almost) as unsaturated as 0.
+		result.Hue, result.Sat = v.Hue, max(v.Sat, 1)
+		if result.Hue == 0 {
+			result.Hue = 65535
+		}
+	}
+	return result
+}
+
+// hueMemberIdsOf returns the IDs of all lights of the given group.
+func hueMemberIdsOf(v *huego.Group) []int {
+	result := make([]int, 0, len(v.Lights))
+	for _, plain := range v.Lights {
+		if id, err := strconv.Atoi(plain); err == nil {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func (this *Hue) snapshotsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve user configuration directory for HUE snapshots: %w", err)
+	}
+	return filepath.Join(dir, "talk-indicator", "hue-snapshots.json"), nil
+}
+
+func (this *Hue) readSnapshots() (HueSnapshots, error) {
+	file, err := this.snapshotsFile()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return HueSnapshots{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read HUE snapshots from %s: %w", file, err)
+	}
+	result := HueSnapshots{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("cannot parse HUE snapshots of %s: %w", file, err)
+	}
+	return result, nil
+}
+
+func (this *Hue) storeSnapshots() error {
+	file, err := this.snapshotsFile()
+	if err != nil {
+		return err
+	}
+	if len(this.snapshots) == 0 {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("cannot delete HUE snapshots %s: %w", file, err)
+		}
+		return nil
+	}
+	b, err := json.Marshal(this.snapshots)
+	if err != nil {
+		return fmt.Errorf("cannot marshal HUE snapshots to JSON: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("cannot create directory for HUE snapshots %s: %w", file, err)
+	}
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		return fmt.Errorf("cannot store HUE snapshots to %s: %w", file, err)
+	}
+	return nil
+}
+
+// takeSnapshot remembers the current state of the given target, if there is
+// not already one. The state is retrieved from the bridge using current; if
+// this fails fallback is used.
+func (this *Hue) takeSnapshot(key string, current func() (*huego.State, error), fallback *huego.State) {
+	if this.OffMode != HueOffModeRestore {
+		return
+	}
+	if _, ok := this.snapshots[key]; ok {
+		return
+	}
+	v, err := current()
+	if err != nil || v == nil {
+		log.WithError(err).
+			With("target", key).
+			Warn("Cannot retrieve current state for snapshot; using the last known one.")
+		v = fallback
+	}
+	if v == nil {
+		return
+	}
+	this.snapshots[key] = hueSnapshotOf(*v)
+	if err := this.storeSnapshots(); err != nil {
+		log.WithError(err).
+			Warn("Cannot store snapshots. They will be lost on restart.")
+	}
+}
+
+// takeMemberSnapshots remembers the current state of every light of the
+// given group, if there is not already one.
+func (this *Hue) takeMemberSnapshots(bridge hueBridge, v *huego.Group) {
+	for _, id := range hueMemberIdsOf(v) {
+		this.takeSnapshot(hueTargetKey(HueKindLight, id), func() (*huego.State, error) {
+			current, err := bridge.GetLight(id)
+			if err != nil {
+				return nil, err
+			}
+			return current.State, nil
+		}, nil)
+	}
+}
+
+// hasMemberSnapshots reports if a snapshot exists for any light of the given
+// group.
+func (this *Hue) hasMemberSnapshots(v *huego.Group) bool {
+	for _, id := range hueMemberIdsOf(v) {
+		if _, ok := this.snapshots[hueTargetKey(HueKindLight, id)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreMembers restores every light of the given group a snapshot exists
+// for.
+func (this *Hue) restoreMembers(bridge hueBridge, v *huego.Group) error {
+	restored, anyOn := false, false
+	for _, id := range hueMemberIdsOf(v) {
+		key := hueTargetKey(HueKindLight, id)
+		snapshot, ok := this.snapshots[key]
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		_, err := bridge.SetLightState(id, hueRestoreStateOf(snapshot))
+		metrics.Observe(metrics.HueRequestDuration.WithLabelValues("setLightState"), start)
+		if err != nil {
+			return fmt.Errorf("cannot restore hue light #%d of group %q#%d: %w", id, v.Name, v.ID, err)
+		}
+		this.dropSnapshot(key)
+		restored, anyOn = true, anyOn || snapshot.On
+	}
+	if restored {
+		// What the group looks like now is only known by its lights.
+		v.State = &huego.State{On: anyOn}
+	}
+	return nil
+}
+
+func (this *Hue) dropSnapshot(key string) {
+	if _, ok := this.snapshots[key]; !ok {
+		return
+	}
+	delete(this.snapshots, key)
+	if err := this.storeSnapshots(); err != nil {
+		log.WithError(err).
+			Warn("Cannot store snapshots.")
+	}
+}
+
+// markSignaled remembers if the given target was switched to any other state
+// than StateOff by this instance. If its snapshot gets lost in the meantime,
+// it is switched off instead of being restored.
+func (this *Hue) markSignaled(key string, signaled bool) {
+	if !signaled {
+		delete(this.signaled, key)
+		return
+	}
+	if this.signaled == nil {
+		this.signaled = map[string]bool{}
+	}
+	this.signaled[key] = true
+}
+
+// forgetSnapshots removes the snapshots of the given targets, which were
+// released (and restored) by a predecessor of this instance. The remaining
+// ones are persisted again, as the predecessor has overwritten them with its
+// own while releasing.
+func (this *Hue) forgetSnapshots(keys []string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(this.snapshots, key)
+	}
+	if err := this.storeSnapshots(); err != nil {
+		log.WithError(err).
+			Warn("Cannot store snapshots.")
+	}
+}
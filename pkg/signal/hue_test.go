@@ -0,0 +1,385 @@
+package signal
+
+import (
+	"fmt"
+	"github.com/amimof/huego"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHue_Release(t *testing.T) {
+	bridge := newHueTestBridge()
+	old := newHueTestInstance(bridge,
+		[]huego.Light{{ID: 1, Name: "Desk"}, {ID: 2, Name: "Shelf"}},
+		[]huego.Group{{ID: 3, Name: "Office"}},
+	)
+	next := newHueTestInstance(bridge,
+		[]huego.Light{{ID: 2, Name: "Shelf"}},
+		nil,
+	)
+	for _, v := range []*Hue{old, next} {
+		if err := v.Ensure(StateOn); err != nil {
+			t.Fatalf("Ensure() failed: %v", err)
+		}
+	}
+	bridge.reset()
+
+	if err := old.Release(next); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+
+	expected := []hueTestCall{
+		{"light/1", huego.State{On: false}},
+		{"group/3", huego.State{On: false}},
+	}
+	if actual := bridge.recorded(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("calls = %+v; want %+v", actual, expected)
+	}
+}
+
+func TestHue_Release_otherBridge(t *testing.T) {
+	old := newHueTestInstance(newHueTestBridge(), []huego.Light{{ID: 1, Name: "Desk"}}, nil)
+	if err := old.Ensure(StateOn); err != nil {
+		t.Fatalf("Ensure() failed: %v", err)
+	}
+	otherBridge := newHueTestBridge()
+	otherBridge.host = "192.168.0.2"
+	next := newHueTestInstance(otherBridge, []huego.Light{{ID: 1, Name: "Desk"}}, nil)
+	old.client.(*hueTestBridge).reset()
+
+	if err := old.Release(next); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+
+	expected := []hueTestCall{{"light/1", huego.State{On: false}}}
+	if actual := old.client.(*hueTestBridge).recorded(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("calls = %+v; want %+v", actual, expected)
+	}
+}
+
+func TestHue_identify(t *testing.T) {
+	bridge := newHueTestBridge()
+	bridge.addLight(1, "Desk", huego.State{On: false})
+	bridge.addLight(2, "Shelf", huego.State{On: true})
+	bridge.addLight(3, "desk", huego.State{On: true})
+	bridge.addGroup(4, "Office", huego.State{On: false})
+	instance := newHueTestInstance(bridge, nil, nil)
+
+	entries, err := instance.identify(bridge, "desk", time.Millisecond)
+	if err != nil {
+		t.Fatalf("identify() failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("identify() = %+v; want lights 1 and 3", entries)
+	}
+
+	alert := huego.State{On: true, Alert: "lselect"}
+	expected := []hueTestCall{
+		{"light/1", alert},
+		{"light/3", alert},
+		// Only what was off before is switched off again.
+		{"light/1", huego.State{On: false}},
+	}
+	if actual := bridge.recorded(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("calls = %+v; want %+v", actual, expected)
+	}
+}
+
+func TestHue_identify_group(t *testing.T) {
+	bridge := newHueTestBridge()
+	bridge.addGroup(4, "Office", huego.State{On: false})
+	instance := newHueTestInstance(bridge, nil, nil)
+
+	if _, err := instance.identify(bridge, "4", time.Millisecond); err != nil {
+		t.Fatalf("identify() failed: %v", err)
+	}
+
+	expected := []hueTestCall{
+		{"group/4", huego.State{On: true, Alert: "lselect"}},
+		{"group/4", huego.State{On: false}},
+	}
+	if actual := bridge.recorded(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("calls = %+v; want %+v", actual, expected)
+	}
+	if _, err := instance.identify(bridge, "unknown", time.Millisecond); err == nil {
+		t.Errorf("identify() of unknown should fail")
+	}
+}
+
+func TestHue_ensureGroup_restoresLights(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	bridge := newHueTestBridge()
+	bridge.addLight(1, "Desk", huego.State{On: true, Bri: 100, Ct: 366, ColorMode: "ct"})
+	bridge.addLight(2, "Shelf", huego.State{On: false, Bri: 254, Hue: 0, Sat: 254, ColorMode: "hs"})
+	// The action of the group does not tell anything about its lights.
+	bridge.addGroup(3, "Office", huego.State{On: true, Bri: 1, Ct: 153, ColorMode: "ct"}, "1", "2")
+	instance := newHueTestInstance(bridge, nil, []huego.Group{{ID: 3, Name: "Office", Lights: []string{"1", "2"}}})
+	instance.OffMode = HueOffModeRestore
+
+	if err := instance.Ensure(StateOn); err != nil {
+		t.Fatalf("Ensure(on) failed: %v", err)
+	}
+	if _, ok := instance.snapshots["group/3"]; ok || len(instance.snapshots) != 2 {
+		t.Errorf("snapshots = %+v; want light/1 and light/2", instance.snapshots)
+	}
+	bridge.reset()
+
+	if err := instance.Ensure(StateOff); err != nil {
+		t.Fatalf("Ensure(off) failed: %v", err)
+	}
+
+	expected := []hueTestCall{
+		{"light/1", huego.State{On: true, Bri: 100, Ct: 366}},
+		{"light/2", huego.State{On: false}},
+	}
+	if actual := bridge.recorded(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("calls = %+v; want %+v", actual, expected)
+	}
+	if len(instance.snapshots) != 0 {
+		t.Errorf("snapshots = %+v; want none", instance.snapshots)
+	}
+}
+
+func TestHue_Ensure_restoreWithoutSnapshot(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	bridge := newHueTestBridge()
+	instance := newHueTestInstance(bridge, []huego.Light{{ID: 1, Name: "Desk"}, {ID: 2, Name: "Shelf"}, {ID: 3, Name: "Door"}}, nil)
+	instance.OffMode = HueOffModeRestore
+
+	// Door is signaled by this instance, but was dimmed in the meantime.
+	if err := instance.ensureLight(bridge, StateOn, &instance.lights[2]); err != nil {
+		t.Fatalf("ensureLight() failed: %v", err)
+	}
+	instance.lights[2].State.Bri = 100
+	// Desk still shows muted from before a restart.
+	instance.lights[0].State = &huego.State{On: true, Bri: 150, Hue: 6000, Sat: 254}
+	instance.lights[1].State = &huego.State{On: true, Bri: 100, Ct: 366, ColorMode: "ct"}
+	// The snapshots got lost.
+	instance.snapshots = HueSnapshots{}
+	bridge.reset()
+
+	if err := instance.Ensure(StateOff); err != nil {
+		t.Fatalf("Ensure(off) failed: %v", err)
+	}
+	expected := []hueTestCall{
+		{"light/1", huego.State{On: false}},
+		{"light/3", huego.State{On: false}},
+	}
+	if actual := bridge.recorded(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("calls = %+v; want %+v", actual, expected)
+	}
+
+	// Lights which are not signaled are left untouched.
+	bridge.reset()
+	instance.lights[2].State = &huego.State{On: true, Bri: 100, Ct: 366, ColorMode: "ct"}
+	if err := instance.Ensure(StateOff); err != nil {
+		t.Fatalf("Ensure(off) failed: %v", err)
+	}
+	if actual := bridge.recorded(); len(actual) > 0 {
+		t.Errorf("calls = %+v; want none", actual)
+	}
+}
+
+func TestHueRestoreStateOf(t *testing.T) {
+	cases := []struct {
+		name     string
+		snapshot huego.State
+		expected huego.State
+	}{
+		{"off", huego.State{On: false, Bri: 100, Ct: 366, ColorMode: "ct"}, huego.State{On: false}},
+		{"ct", huego.State{On: true, Bri: 100, Hue: 8000, Ct: 366, ColorMode: "ct"}, huego.State{On: true, Bri: 100, Ct: 366}},
+		{"xy", huego.State{On: true, Bri: 100, Xy: []float32{0.3, 0.3}, ColorMode: "xy"}, huego.State{On: true, Bri: 100, Xy: []float32{0.3, 0.3}}},
+		{"hs", huego.State{On: true, Bri: 100, Hue: 46920, Sat: 254, ColorMode: "hs"}, huego.State{On: true, Bri: 100, Hue: 46920, Sat: 254}},
+		{"hs red", huego.State{On: true, Bri: 100, Hue: 0, Sat: 254, ColorMode: "hs"}, huego.State{On: true, Bri: 100, Hue: 65535, Sat: 254}},
+		{"hs unsaturated", huego.State{On: true, Bri: 100, Hue: 46920, Sat: 0, ColorMode: "hs"}, huego.State{On: true, Bri: 100, Hue: 46920, Sat: 1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := hueRestoreStateOf(c.snapshot); !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("hueRestoreStateOf() = %+v; want %+v", actual, c.expected)
+			}
+		})
+	}
+}
+
+// newHueTestInstance creates a Hue which is already initialized with the
+// given lights and groups (which are all switched off).
+func newHueTestInstance(bridge *hueTestBridge, lights []huego.Light, groups []huego.Group) *Hue {
+	result := &Hue{
+		Kinds:      AllHueKinds,
+		Name:       regexp.MustCompile(".*"),
+		Britness:   254,
+		Hue:        0,
+		Saturation: 254,
+		OffMode:    HueOffModeOff,
+		snapshots:  HueSnapshots{},
+	}
+	result.credentials = HueCredentials{Host: bridge.host, User: "test"}
+	result.client = bridge
+	for _, v := range lights {
+		v.State = &huego.State{}
+		result.lights = append(result.lights, v)
+	}
+	for _, v := range groups {
+		v.State = &huego.State{}
+		result.groups = append(result.groups, v)
+	}
+	return result
+}
+
+type hueTestCall struct {
+	Target string
+	State  huego.State
+}
+
+// hueTestBridge holds lights and groups in memory and records every state
+// which is set.
+type hueTestBridge struct {
+	host   string
+	lights map[int]huego.Light
+	groups map[int]huego.Group
+	scenes []huego.Scene
+	calls  []hueTestCall
+	mutex  sync.Mutex
+}
+
+func newHueTestBridge() *hueTestBridge {
+	return &hueTestBridge{
+		host:   "192.168.0.1",
+		lights: map[int]huego.Light{},
+		groups: map[int]huego.Group{},
+	}
+}
+
+func (this *hueTestBridge) addLight(id int, name string, state huego.State) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.lights[id] = huego.Light{ID: id, Name: name, State: &state}
+}
+
+func (this *hueTestBridge) addGroup(id int, name string, state huego.State, lights ...string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.groups[id] = huego.Group{ID: id, Name: name, Lights: lights, State: &state, GroupState: &huego.GroupState{AnyOn: state.On}}
+}
+
+func (this *hueTestBridge) reset() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.calls = nil
+}
+
+func (this *hueTestBridge) recorded() []hueTestCall {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return append([]hueTestCall(nil), this.calls...)
+}
+
+func (this *hueTestBridge) GetLights() (result []huego.Light, _ error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, id := range slices.Sorted(maps.Keys(this.lights)) {
+		result = append(result, hueTestCopyOfLight(this.lights[id]))
+	}
+	return result, nil
+}
+
+func (this *hueTestBridge) GetLight(id int) (*huego.Light, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	v, ok := this.lights[id]
+	if !ok {
+		return nil, fmt.Errorf("no light %d", id)
+	}
+	result := hueTestCopyOfLight(v)
+	return &result, nil
+}
+
+func (this *hueTestBridge) SetLightState(id int, state huego.State) (*huego.Response, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.calls = append(this.calls, hueTestCall{hueTargetKey(HueKindLight, id), state})
+	if v, ok := this.lights[id]; ok {
+		applied := hueTestApply(*v.State, state)
+		v.State = &applied
+		this.lights[id] = v
+	}
+	return &huego.Response{}, nil
+}
+
+func (this *hueTestBridge) GetGroups() (result []huego.Group, _ error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, id := range slices.Sorted(maps.Keys(this.groups)) {
+		result = append(result, hueTestCopyOfGroup(this.groups[id]))
+	}
+	return result, nil
+}
+
+func (this *hueTestBridge) SetGroupState(id int, state huego.State) (*huego.Response, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.calls = append(this.calls, hueTestCall{hueTargetKey(HueKindGroup, id), state})
+	if v, ok := this.groups[id]; ok {
+		applied := hueTestApply(*v.State, state)
+		v.State = &applied
+		v.GroupState = &huego.GroupState{AnyOn: applied.On}
+		this.groups[id] = v
+	}
+	return &huego.Response{}, nil
+}
+
+func (this *hueTestBridge) GetScenes() ([]huego.Scene, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.scenes, nil
+}
+
+func (this *hueTestBridge) RecallScene(id string, groupId int) (*huego.Response, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.calls = append(this.calls, hueTestCall{fmt.Sprintf("scene/%s@%d", id, groupId), huego.State{}})
+	return &huego.Response{}, nil
+}
+
+func (this *hueTestBridge) String() string {
+	return this.host
+}
+
+func hueTestCopyOfLight(v huego.Light) huego.Light {
+	state := *v.State
+	v.State = &state
+	return v
+}
+
+func hueTestCopyOfGroup(v huego.Group) huego.Group {
+	state, groupState := *v.State, *v.GroupState
+	v.State, v.GroupState = &state, &groupState
+	return v
+}
+
+// hueTestApply applies the given update like the bridge does: On is always
+// applied, everything else only if present.
+func hueTestApply(current, update huego.State) huego.State {
+	current.On = update.On
+	if update.Bri != 0 {
+		current.Bri = update.Bri
+	}
+	if update.Hue != 0 || update.Sat != 0 {
+		current.Hue, current.Sat, current.ColorMode = update.Hue, update.Sat, "hs"
+	}
+	if len(update.Xy) > 0 {
+		current.Xy, current.ColorMode = update.Xy, "xy"
+	}
+	if update.Ct != 0 {
+		current.Ct, current.ColorMode = update.Ct, "ct"
+	}
+	return current
+}
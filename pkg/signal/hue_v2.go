@@ -0,0 +1,734 @@
+package signal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/amimof/huego"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hueV2Client uses the CLIP API v2 of the bridge via HTTPS. The resources of
+// this API are mapped to the ones of the v1 API by their id_v1, which the
+// bridge still provides for all of them; resources without one are ignored,
+// except scenes which are then addressed by their v2 ID.
+type hueV2Client struct {
+	host   string
+	key    string
+	client *http.Client
+	stream *http.Client
+
+	// ids holds the v2 IDs by hueTargetKey (or scene/<id>) of what was
+	// discovered last.
+	ids map[string]string
+	// groups holds the v1 IDs of rooms and zones by their v2 ID.
+	groups map[string]int
+	// scenes holds the scenes (as returned by GetScenes) by their v2 ID.
+	scenes map[string]huego.Scene
+	// sent holds the last state which was set by their v2 ID.
+	sent  map[string]huego.State
+	mutex sync.Mutex
+}
+
+type hueV2Reference struct {
+	Rid   string `json:"rid"`
+	Rtype string `json:"rtype"`
+}
+
+type hueV2Metadata struct {
+	Name      string `json:"name,omitempty"`
+	Archetype string `json:"archetype,omitempty"`
+}
+
+type hueV2On struct {
+	On bool `json:"on"`
+}
+
+type hueV2Dimming struct {
+	Brightness float64 `json:"brightness"`
+}
+
+type hueV2Xy struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type hueV2Color struct {
+	Xy *hueV2Xy `json:"xy,omitempty"`
+}
+
+type hueV2ColorTemperature struct {
+	Mirek      *uint16 `json:"mirek,omitempty"`
+	MirekValid bool    `json:"mirek_valid,omitempty"`
+}
+
+type hueV2Action struct {
+	Action string `json:"action,omitempty"`
+}
+
+// hueV2Status is either a plain string (like the one of a
+// zigbee_connectivity) or an object (like the one of a scene).
+type hueV2Status struct {
+	Value string
+	// Active is inactive, static or dynamic_palette for scenes.
+	Active string
+}
+
+func (this *hueV2Status) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &this.Value)
+	}
+	var v struct {
+		Active string `json:"active"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	this.Active = v.Active
+	return nil
+}
+
+// hueV2Resource contains all properties of all types of resources which are
+// of interest. It is used for requests, responses and events.
+type hueV2Resource struct {
+	ID               string                 `json:"id,omitempty"`
+	IDv1             string                 `json:"id_v1,omitempty"`
+	Type             string                 `json:"type,omitempty"`
+	Owner            *hueV2Reference        `json:"owner,omitempty"`
+	Metadata         *hueV2Metadata         `json:"metadata,omitempty"`
+	On               *hueV2On               `json:"on,omitempty"`
+	Dimming          *hueV2Dimming          `json:"dimming,omitempty"`
+	Color            *hueV2Color            `json:"color,omitempty"`
+	ColorTemperature *hueV2ColorTemperature `json:"color_temperature,omitempty"`
+	Alert            *hueV2Action           `json:"alert,omitempty"`
+	Recall           *hueV2Action           `json:"recall,omitempty"`
+	Services         []hueV2Reference       `json:"services,omitempty"`
+	Children         []hueV2Reference       `json:"children,omitempty"`
+	Group            *hueV2Reference        `json:"group,omitempty"`
+	Status           *hueV2Status           `json:"status,omitempty"`
+}
+
+func (this hueV2Resource) name() string {
+	if v := this.Metadata; v != nil {
+		return v.Name
+	}
+	return ""
+}
+
+func (this *Hue) newV2Client(credentials HueCredentials) (*hueV2Client, error) {
+	config, err := this.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	host := credentials.Host
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("illegal-signal-hue-bridge: %s", host)
+		}
+		host = u.Host
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig:     config,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &hueV2Client{
+		host: host,
+		key:  credentials.User,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   10 * time.Second,
+		},
+		// The event stream lasts forever.
+		stream: &http.Client{
+			Transport: transport,
+		},
+		ids:    map[string]string{},
+		groups: map[string]int{},
+		scenes: map[string]huego.Scene{},
+		sent:   map[string]huego.State{},
+	}, nil
+}
+
+// tlsConfig validates the certificate of the bridge using either the
+// configured certificate authority or fingerprint. The bridges are using
+// certificates which have their ID as common name instead of their host,
+// therefore the validation has to be done by ourselves.
+func (this *Hue) tlsConfig() (*tls.Config, error) {
+	var roots *x509.CertPool
+	if file := this.CertificateAuthority; file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read certificate authority of hue bridge from %s: %w", file, err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("cannot read certificate authority of hue bridge from %s: no PEM encoded certificate found", file)
+		}
+	}
+	fingerprint := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(this.Fingerprint), ":", ""))
+	if roots == nil && fingerprint == "" {
+		return nil, fmt.Errorf("cannot validate certificate of hue bridge: neither signal.hue.ca nor signal.hue.fingerprint is configured")
+	}
+	bridgeId := this.BridgeId
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Validated by VerifyConnection.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("hue bridge presented no certificate")
+			}
+			leaf := state.PeerCertificates[0]
+			if fingerprint != "" {
+				if sum := sha256.Sum256(leaf.Raw); hex.EncodeToString(sum[:]) != fingerprint {
+					return fmt.Errorf("certificate of hue bridge does not match fingerprint %s", this.Fingerprint)
+				}
+			}
+			if roots != nil {
+				intermediates := x509.NewCertPool()
+				for _, v := range state.PeerCertificates[1:] {
+					intermediates.AddCert(v)
+				}
+				if _, err := leaf.Verify(x509.VerifyOptions{
+					Roots:         roots,
+					Intermediates: intermediates,
+				}); err != nil {
+					return fmt.Errorf("certificate of hue bridge is not valid: %w", err)
+				}
+			}
+			if bridgeId != "" && !strings.EqualFold(leaf.Subject.CommonName, bridgeId) {
+				return fmt.Errorf("certificate of hue bridge is issued for %q instead of %q", leaf.Subject.CommonName, bridgeId)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// createUser registers a new user (application key) at the bridge like
+// huego.Bridge.CreateUser does, but via HTTPS validating the certificate of
+// the bridge. Errors reported by the bridge are returned as *huego.APIError.
+func (this *hueV2Client) createUser(deviceType string) (string, error) {
+	b, err := json.Marshal(map[string]string{"devicetype": deviceType})
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal request to create user: %w", err)
+	}
+	resp, err := this.client.Post(this.String()+"/api", "application/json", bytes.NewReader(b))
+	if err != nil {
+		// Already contains method and URL.
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var responses []struct {
+		Success *struct {
+			Username string `json:"username"`
+		} `json:"success"`
+		Error *huego.APIError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return "", fmt.Errorf("cannot parse response of POST /api: %w", err)
+	}
+	for _, v := range responses {
+		if v.Error != nil {
+			return "", v.Error
+		}
+		if v.Success != nil && v.Success.Username != "" {
+			return v.Success.Username, nil
+		}
+	}
+	return "", fmt.Errorf("POST /api failed: %s", resp.Status)
+}
+
+func (this *hueV2Client) String() string {
+	return "https://" + this.host
+}
+
+func (this *hueV2Client) GetLights() ([]huego.Light, error) {
+	resources, err := this.resources("light")
+	if err != nil {
+		return nil, err
+	}
+	connectivities, err := this.resources("zigbee_connectivity")
+	if err != nil {
+		return nil, err
+	}
+	connected := map[string]bool{}
+	for _, v := range connectivities {
+		if v.Owner != nil {
+			connected[v.Owner.Rid] = v.Status != nil && v.Status.Value == "connected"
+		}
+	}
+
+	var result []huego.Light
+	for _, v := range resources {
+		id, ok := hueV1IdOf(v.IDv1, "/lights/")
+		if !ok {
+			continue
+		}
+		this.remember(hueTargetKey(HueKindLight, id), v.ID)
+		light := this.lightOf(id, v)
+		light.State.Reachable = true
+		if v.Owner != nil {
+			if c, ok := connected[v.Owner.Rid]; ok {
+				light.State.Reachable = c
+			}
+		}
+		result = append(result, light)
+	}
+	return result, nil
+}
+
+func (this *hueV2Client) GetLight(id int) (*huego.Light, error) {
+	v, err := this.resourceOf(HueKindLight, id, "light")
+	if err != nil {
+		return nil, err
+	}
+	result := this.lightOf(id, v)
+	return &result, nil
+}
+
+func (this *hueV2Client) lightOf(id int, v hueV2Resource) huego.Light {
+	state := this.stateOf(v, huego.State{})
+	result := huego.Light{
+		ID:    id,
+		Name:  v.name(),
+		State: &state,
+	}
+	if v.Metadata != nil {
+		result.Type = v.Metadata.Archetype
+	}
+	return result
+}
+
+func (this *hueV2Client) SetLightState(id int, state huego.State) (*huego.Response, error) {
+	return this.setState(HueKindLight, id, "light", state)
+}
+
+// GetGroups returns all rooms and zones, each with the state of its
+// grouped_light (including the ID of its active scene) and the v1 IDs of its
+// lights.
+func (this *hueV2Client) GetGroups() ([]huego.Group, error) {
+	groupedLights, err := this.resources("grouped_light")
+	if err != nil {
+		return nil, err
+	}
+	byId := map[string]hueV2Resource{}
+	for _, v := range groupedLights {
+		byId[v.ID] = v
+	}
+	members, err := this.groupMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []huego.Group
+	for _, t := range []string{"room", "zone"} {
+		resources, err := this.resources(t)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range resources {
+			id, ok := hueV1IdOf(v.IDv1, "/groups/")
+			if !ok {
+				continue
+			}
+			this.mutex.Lock()
+			this.groups[v.ID] = id
+			this.mutex.Unlock()
+			for _, service := range v.Services {
+				if service.Rtype != "grouped_light" {
+					continue
+				}
+				this.remember(hueTargetKey(HueKindGroup, id), service.Rid)
+				state := this.stateOf(byId[service.Rid], huego.State{})
+				result = append(result, huego.Group{
+					ID:         id,
+					Name:       v.name(),
+					Type:       v.Type,
+					Lights:     members(v),
+					State:      &state,
+					GroupState: &huego.GroupState{AnyOn: state.On},
+				})
+			}
+		}
+	}
+
+	_, active, err := this.discoverScenes()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range result {
+		v.State.Scene = active[strconv.Itoa(v.ID)]
+	}
+	return result, nil
+}
+
+// groupMembers returns a function which resolves the v1 IDs of all lights
+// of a room (whose children are devices) or zone (whose children are lights).
+func (this *hueV2Client) groupMembers() (func(hueV2Resource) []string, error) {
+	lights, err := this.resources("light")
+	if err != nil {
+		return nil, err
+	}
+	byId := map[string]string{}
+	byOwner := map[string][]string{}
+	for _, v := range lights {
+		id, ok := hueV1IdOf(v.IDv1, "/lights/")
+		if !ok {
+			continue
+		}
+		byId[v.ID] = strconv.Itoa(id)
+		if v.Owner != nil {
+			byOwner[v.Owner.Rid] = append(byOwner[v.Owner.Rid], strconv.Itoa(id))
+		}
+	}
+
+	return func(group hueV2Resource) (result []string) {
+		for _, child := range group.Children {
+			switch child.Rtype {
+			case "device":
+				result = append(result, byOwner[child.Rid]...)
+			case "light":
+				if id, ok := byId[child.Rid]; ok {
+					result = append(result, id)
+				}
+			}
+		}
+		return
+	}, nil
+}
+
+func (this *hueV2Client) SetGroupState(id int, state huego.State) (*huego.Response, error) {
+	return this.setState(HueKindGroup, id, "grouped_light", state)
+}
+
+// GetScenes returns all scenes; their Group is the v1 ID of the room or zone
+// they belong to.
+func (this *hueV2Client) GetScenes() ([]huego.Scene, error) {
+	this.mutex.Lock()
+	known := len(this.groups) > 0
+	this.mutex.Unlock()
+	if !known {
+		if _, err := this.GetGroups(); err != nil {
+			return nil, err
+		}
+	}
+
+	result, _, err := this.discoverScenes()
+	return result, err
+}
+
+// discoverScenes returns all scenes and the IDs of the active ones by the v1
+// ID of their group. The groups have to be discovered before.
+func (this *hueV2Client) discoverScenes() (result []huego.Scene, active map[string]string, _ error) {
+	resources, err := this.resources("scene")
+	if err != nil {
+		return nil, nil, err
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	active = map[string]string{}
+	for _, v := range resources {
+		scene := huego.Scene{
+			ID:   v.ID,
+			Name: v.name(),
+		}
+		if id, ok := strings.CutPrefix(v.IDv1, "/scenes/"); ok && id != "" {
+			scene.ID = id
+		}
+		this.ids["scene/"+scene.ID] = v.ID
+		if v.Group != nil {
+			if id, ok := this.groups[v.Group.Rid]; ok {
+				scene.Group = strconv.Itoa(id)
+			}
+		}
+		this.scenes[v.ID] = scene
+		if v.Status != nil && v.Status.Active != "" && v.Status.Active != "inactive" && scene.Group != "" {
+			active[scene.Group] = scene.ID
+		}
+		result = append(result, scene)
+	}
+	return result, active, nil
+}
+
+// RecallScene recalls the given scene. Scenes of the v2 API always belong to
+// exactly one room or zone, therefore groupId is ignored.
+func (this *hueV2Client) RecallScene(id string, _ int) (*huego.Response, error) {
+	this.mutex.Lock()
+	rid, ok := this.ids["scene/"+id]
+	this.mutex.Unlock()
+	if !ok {
+		rid = id
+	}
+	if err := this.do(http.MethodPut, "/clip/v2/resource/scene/"+rid, hueV2Resource{
+		Recall: &hueV2Action{Action: "active"},
+	}, nil); err != nil {
+		return nil, err
+	}
+	return &huego.Response{}, nil
+}
+
+func (this *hueV2Client) setState(kind HueKind, id int, resourceType string, state huego.State) (*huego.Response, error) {
+	rid, err := this.idOf(kind, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := this.do(http.MethodPut, "/clip/v2/resource/"+resourceType+"/"+rid, hueV2UpdateOf(state), nil); err != nil {
+		return nil, err
+	}
+	this.mutex.Lock()
+	this.sent[rid] = state
+	this.mutex.Unlock()
+	return &huego.Response{}, nil
+}
+
+// hueV2UpdateOf translates the given v1 state into a v2 update. The hue and
+// saturation are translated into the corresponding xy colour.
+func hueV2UpdateOf(state huego.State) hueV2Resource {
+	result := hueV2Resource{
+		On: &hueV2On{On: state.On},
+	}
+	if state.Alert != "" && state.Alert != "none" {
+		result.Alert = &hueV2Action{Action: "breathe"}
+	}
+	if !state.On {
+		return result
+	}
+	if state.Bri > 0 {
+		result.Dimming = &hueV2Dimming{Brightness: float64(state.Bri) * 100 / 254}
+	}
+	switch {
+	case len(state.Xy) == 2:
+		result.Color = &hueV2Color{Xy: &hueV2Xy{X: float64(state.Xy[0]), Y: float64(state.Xy[1])}}
+	case state.Ct > 0:
+		ct := state.Ct
+		result.ColorTemperature = &hueV2ColorTemperature{Mirek: &ct}
+	case state.Hue > 0 || state.Sat > 0:
+		x, y := hueXyOf(state.Hue, state.Sat)
+		result.Color = &hueV2Color{Xy: &hueV2Xy{X: x, Y: y}}
+	}
+	return result
+}
+
+// stateOf applies all properties present at the given resource to base and
+// returns the result.
+//
+// The v2 API knows nothing about hue and saturation. If the result still
+// looks like what was set last, its hue and saturation are used; otherwise
+// they are 0 which lets Hue ensure its colour again.
+func (this *hueV2Client) stateOf(v hueV2Resource, base huego.State) huego.State {
+	result := base
+	if v.On != nil {
+		result.On = v.On.On
+	}
+	if v.Dimming != nil {
+		result.Bri = uint8(math.Round(v.Dimming.Brightness * 254 / 100))
+	}
+	if ct := v.ColorTemperature; ct != nil && ct.MirekValid && ct.Mirek != nil {
+		result.Ct, result.Xy, result.ColorMode = *ct.Mirek, nil, "ct"
+	} else if c := v.Color; c != nil && c.Xy != nil {
+		result.Ct, result.Xy, result.ColorMode = 0, []float32{float32(c.Xy.X), float32(c.Xy.Y)}, "xy"
+	}
+
+	result.Hue, result.Sat = 0, 0
+	this.mutex.Lock()
+	sent, ok := this.sent[v.ID]
+	this.mutex.Unlock()
+	if !ok || !sent.On || !result.On || (sent.Hue == 0 && sent.Sat == 0) {
+		return result
+	}
+	if math.Abs(float64(sent.Bri)-float64(result.Bri)) > 1 {
+		return result
+	}
+	switch result.ColorMode {
+	case "ct":
+		return result
+	case "xy":
+		// The bridge moves the colour into the gamut of the light.
+		x, y := hueXyOf(sent.Hue, sent.Sat)
+		if math.Hypot(x-float64(result.Xy[0]), y-float64(result.Xy[1])) > 0.03 {
+			return result
+		}
+	}
+	result.Bri, result.Hue, result.Sat = sent.Bri, sent.Hue, sent.Sat
+	return result
+}
+
+// hueXyOf converts the given hue and saturation (at full brightness) into
+// the corresponding CIE xy colour.
+func hueXyOf(hue uint16, sat uint8) (float64, float64) {
+	h := float64(hue) / 65535 * 6
+	s := float64(sat) / 254
+	c := s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) % 6 {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := 1 - c
+	r, g, b = hueGammaOf(r+m), hueGammaOf(g+m), hueGammaOf(b+m)
+
+	cx := r*0.664511 + g*0.154324 + b*0.162028
+	cy := r*0.283881 + g*0.668433 + b*0.047685
+	cz := r*0.000088 + g*0.072310 + b*0.986039
+	sum := cx + cy + cz
+	if sum == 0 {
+		return 0, 0
+	}
+	return math.Round(cx/sum*10000) / 10000, math.Round(cy/sum*10000) / 10000
+}
+
+func hueGammaOf(v float64) float64 {
+	if v > 0.04045 {
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return v / 12.92
+}
+
+func hueV1IdOf(idV1 string, prefix string) (int, bool) {
+	plain, ok := strings.CutPrefix(idV1, prefix)
+	if !ok {
+		return 0, false
+	}
+	result, err := strconv.Atoi(plain)
+	if err != nil {
+		return 0, false
+	}
+	return result, true
+}
+
+func (this *hueV2Client) remember(key string, id string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.ids[key] = id
+}
+
+func (this *hueV2Client) idOf(kind HueKind, id int) (string, error) {
+	key := hueTargetKey(kind, id)
+	this.mutex.Lock()
+	result, ok := this.ids[key]
+	this.mutex.Unlock()
+	if ok {
+		return result, nil
+	}
+
+	// Not discovered, yet.
+	var err error
+	if kind == HueKindGroup {
+		_, err = this.GetGroups()
+	} else {
+		_, err = this.GetLights()
+	}
+	if err != nil {
+		return "", err
+	}
+	this.mutex.Lock()
+	result, ok = this.ids[key]
+	this.mutex.Unlock()
+	if !ok {
+		return "", fmt.Errorf("there is no %v with ID %d at bridge %v", kind, id, this)
+	}
+	return result, nil
+}
+
+func (this *hueV2Client) resourceOf(kind HueKind, id int, resourceType string) (hueV2Resource, error) {
+	rid, err := this.idOf(kind, id)
+	if err != nil {
+		return hueV2Resource{}, err
+	}
+	var result []hueV2Resource
+	if err := this.do(http.MethodGet, "/clip/v2/resource/"+resourceType+"/"+rid, nil, &result); err != nil {
+		return hueV2Resource{}, err
+	}
+	if len(result) == 0 {
+		return hueV2Resource{}, fmt.Errorf("there is no %v with ID %d at bridge %v", kind, id, this)
+	}
+	return result[0], nil
+}
+
+func (this *hueV2Client) resources(resourceType string) ([]hueV2Resource, error) {
+	var result []hueV2Resource
+	if err := this.do(http.MethodGet, "/clip/v2/resource/"+resourceType, nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *hueV2Client) do(method string, path string, body any, result *[]hueV2Resource) error {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("cannot marshal request %s %s: %w", method, path, err)
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, this.String()+path, payload)
+	if err != nil {
+		return fmt.Errorf("cannot create request %s %s: %w", method, path, err)
+	}
+	req.Header.Set("hue-application-key", this.key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		// Already contains method and URL.
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var envelope struct {
+		Errors []struct {
+			Description string `json:"description"`
+		} `json:"errors"`
+		Data []hueV2Resource `json:"data"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&envelope)
+	if len(envelope.Errors) > 0 {
+		var descriptions []string
+		for _, v := range envelope.Errors {
+			descriptions = append(descriptions, v.Description)
+		}
+		return fmt.Errorf("%s %s failed: %s", method, path, strings.Join(descriptions, "; "))
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s failed: %s", method, path, resp.Status)
+	}
+	if decodeErr != nil && !errors.Is(decodeErr, io.EOF) {
+		return fmt.Errorf("cannot parse response of %s %s: %w", method, path, decodeErr)
+	}
+	if result != nil {
+		*result = envelope.Data
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package signal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/amimof/huego"
+	log "github.com/echocat/slf4g"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const hueV2EventStreamRetry = 5 * time.Second
+
+// watch subscribes to the event stream of the bridge and calls handle for
+// each updated resource until ctx is done. If the connection gets lost it is
+// reestablished.
+func (this *hueV2Client) watch(ctx context.Context, handle func(hueV2Resource)) {
+	for {
+		err := this.subscribe(ctx, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		log.WithError(err).
+			With("bridge", this).
+			Warn("Event stream of hue bridge interrupted; reconnecting...")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(hueV2EventStreamRetry):
+		}
+	}
+}
+
+func (this *hueV2Client) subscribe(ctx context.Context, handle func(hueV2Resource)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, this.String()+"/eventstream/clip/v2", nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request for event stream: %w", err)
+	}
+	req.Header.Set("hue-application-key", this.key)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := this.stream.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot subscribe to event stream of bridge %v: %w", this, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot subscribe to event stream of bridge %v: %s", this, resp.Status)
+	}
+	log.With("bridge", this).
+		Debug("Subscribed to event stream of hue bridge.")
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() > 0 {
+				this.dispatch(data.String(), handle)
+				data.Reset()
+			}
+			continue
+		}
+		// Everything else (like id: or comments) is not of interest.
+		if v, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(v, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read event stream of bridge %v: %w", this, err)
+	}
+	return fmt.Errorf("event stream closed by bridge %v", this)
+}
+
+func (this *hueV2Client) dispatch(data string, handle func(hueV2Resource)) {
+	var events []struct {
+		Type string          `json:"type"`
+		Data []hueV2Resource `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(data), &events); err != nil {
+		log.WithError(err).
+			With("bridge", this).
+			Debug("Cannot parse event of hue bridge; ignoring it.")
+		return
+	}
+	for _, event := range events {
+		if event.Type != "update" {
+			continue
+		}
+		for _, v := range event.Data {
+			handle(v)
+		}
+	}
+}
+
+// onEvent updates the known state of the light or group of the given
+// resource. Changes made outside of this application are therefore ensured
+// again with the next check instead of the next refresh.
+func (this *Hue) onEvent(client *hueV2Client, v hueV2Resource) {
+	if scene, active, ok := client.sceneOf(v); ok {
+		this.onSceneEvent(scene, active)
+		return
+	}
+
+	key, ok := client.keyOf(v)
+	if !ok {
+		return
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for i, light := range this.lights {
+		if hueTargetKey(HueKindLight, light.ID) == key {
+			state := client.stateOf(v, *light.State)
+			this.lights[i].State = &state
+		}
+	}
+	for i, group := range this.groups {
+		if hueTargetKey(HueKindGroup, group.ID) == key {
+			state := client.stateOf(v, *group.State)
+			this.groups[i].State = &state
+		}
+	}
+	log.With("target", key).
+		Debug("State of hue bridge changed.")
+}
+
+// onSceneEvent updates the scene of the group the given scene belongs to.
+func (this *Hue) onSceneEvent(scene huego.Scene, active bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for i, group := range this.groups {
+		if strconv.Itoa(group.ID) != scene.Group {
+			continue
+		}
+		state := *group.State
+		if active {
+			state.Scene = scene.ID
+		} else if state.Scene == scene.ID {
+			state.Scene = ""
+		}
+		this.groups[i].State = &state
+	}
+	log.With("scene", scene.ID).
+		With("active", active).
+		Debug("Scene of hue bridge changed.")
+}
+
+// sceneOf returns the known scene of the given resource and whether it is
+// active now; ok is false if it is no scene, not known or its status did not
+// change.
+func (this *hueV2Client) sceneOf(v hueV2Resource) (scene huego.Scene, active bool, ok bool) {
+	if v.Type != "scene" || v.Status == nil || v.Status.Active == "" {
+		return huego.Scene{}, false, false
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	scene, ok = this.scenes[v.ID]
+	return scene, v.Status.Active != "inactive", ok
+}
+
+// keyOf returns the hueTargetKey of the light or group of the given resource.
+func (this *hueV2Client) keyOf(v hueV2Resource) (string, bool) {
+	switch v.Type {
+	case "light":
+		if id, ok := hueV1IdOf(v.IDv1, "/lights/"); ok {
+			return hueTargetKey(HueKindLight, id), true
+		}
+	case "grouped_light":
+		if id, ok := hueV1IdOf(v.IDv1, "/groups/"); ok {
+			return hueTargetKey(HueKindGroup, id), true
+		}
+	default:
+		return "", false
+	}
+	// Events do not necessarily contain the id_v1.
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for key, id := range this.ids {
+		if id == v.ID && !strings.HasPrefix(key, "scene/") {
+			return key, true
+		}
+	}
+	return "", false
+}
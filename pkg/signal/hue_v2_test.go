@@ -0,0 +1,459 @@
+package signal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/amimof/huego"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const hueV2TestBridgeId = "001788fffe123456"
+
+func TestHue_tlsConfig(t *testing.T) {
+	ca := newHueV2TestCa(t)
+	otherCa := newHueV2TestCa(t)
+	caServer := newHueV2TestServer(t, ca.issue(t, hueV2TestBridgeId))
+	fingerprintServer := newHueV2TestServer(t, nil)
+	sum := sha256.Sum256(fingerprintServer.server.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	cases := []struct {
+		name     string
+		server   *hueV2TestServer
+		hue      *Hue
+		expected string
+	}{{
+		name:   "fingerprint",
+		server: fingerprintServer,
+		hue:    &Hue{Fingerprint: strings.ToUpper(fingerprint[:2]) + ":" + fingerprint[2:]},
+	}, {
+		name:     "wrong fingerprint",
+		server:   fingerprintServer,
+		hue:      &Hue{Fingerprint: strings.Repeat("ab", sha256.Size)},
+		expected: "does not match fingerprint",
+	}, {
+		name:   "certificate authority",
+		server: caServer,
+		hue:    &Hue{CertificateAuthority: ca.file(t), BridgeId: strings.ToUpper(hueV2TestBridgeId)},
+	}, {
+		name:     "wrong certificate authority",
+		server:   caServer,
+		hue:      &Hue{CertificateAuthority: otherCa.file(t)},
+		expected: "is not valid",
+	}, {
+		name:     "wrong bridge ID",
+		server:   caServer,
+		hue:      &Hue{CertificateAuthority: ca.file(t), BridgeId: "001788fffe654321"},
+		expected: `is issued for "` + hueV2TestBridgeId + `"`,
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := c.server.client(t, c.hue)
+			_, err := client.GetLights()
+			if c.expected == "" && err != nil {
+				t.Errorf("GetLights() failed: %v", err)
+			}
+			if c.expected != "" && (err == nil || !strings.Contains(err.Error(), c.expected)) {
+				t.Errorf("GetLights() = %v; want error containing %q", err, c.expected)
+			}
+		})
+	}
+
+	if _, err := (&Hue{}).newV2Client(HueCredentials{Host: "localhost", User: "test"}); err == nil {
+		t.Errorf("newV2Client() without certificate authority or fingerprint should fail")
+	}
+}
+
+func TestHue_PairBridge_v2(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	server := newHueV2TestServer(t, nil)
+	instance := server.hue()
+	instance.Bridge = server.host()
+	instance.Api = HueApiV2
+
+	actual, err := instance.PairBridge()
+	if err != nil {
+		t.Fatalf("PairBridge() failed: %v", err)
+	}
+	if expected := (HueCredentials{Host: server.host(), User: "test"}); actual != expected {
+		t.Errorf("PairBridge() = %+v; want %+v", actual, expected)
+	}
+	request := hueV2TestRequest{Path: "/api", Body: `{"devicetype":"` + appName + `"}`}
+	if actual := server.puts(); !reflect.DeepEqual(actual, []hueV2TestRequest{request, request}) {
+		t.Errorf("requests = %+v; want %+v twice", actual, request)
+	}
+
+	untrusted := &Hue{Bridge: server.host(), Api: HueApiV2, Fingerprint: strings.Repeat("ab", sha256.Size)}
+	if _, err := untrusted.PairBridge(); err == nil || !strings.Contains(err.Error(), "does not match fingerprint") {
+		t.Errorf("PairBridge() = %v; want error containing %q", err, "does not match fingerprint")
+	}
+	if actual := server.puts(); len(actual) > 0 {
+		t.Errorf("requests = %+v; want none with an untrusted certificate", actual)
+	}
+}
+
+func TestHueV2Client_GetLights(t *testing.T) {
+	server := newHueV2TestServer(t, nil)
+	client := server.client(t, server.hue())
+
+	actual, err := client.GetLights()
+	if err != nil {
+		t.Fatalf("GetLights() failed: %v", err)
+	}
+
+	expected := []huego.Light{{
+		ID:    1,
+		Name:  "Desk",
+		Type:  "desk_lamp",
+		State: &huego.State{On: true, Bri: 127, Xy: []float32{0.3, 0.3}, ColorMode: "xy", Reachable: true},
+	}, {
+		ID:    2,
+		Name:  "Shelf",
+		Type:  "flood_bulb",
+		State: &huego.State{On: false, Bri: 254, Ct: 366, ColorMode: "ct", Reachable: false},
+	}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("GetLights() = %s; want %s", hueV2TestJson(actual), hueV2TestJson(expected))
+	}
+}
+
+func TestHueV2Client_GetGroups(t *testing.T) {
+	server := newHueV2TestServer(t, nil)
+	client := server.client(t, server.hue())
+
+	actual, err := client.GetGroups()
+	if err != nil {
+		t.Fatalf("GetGroups() failed: %v", err)
+	}
+
+	expected := []huego.Group{{
+		ID:         1,
+		Name:       "Office",
+		Type:       "room",
+		Lights:     []string{"1"},
+		State:      &huego.State{On: true, Bri: 127, Scene: "AbCdEf"},
+		GroupState: &huego.GroupState{AnyOn: true},
+	}, {
+		ID:         2,
+		Name:       "Shelves",
+		Type:       "zone",
+		Lights:     []string{"2"},
+		State:      &huego.State{On: false},
+		GroupState: &huego.GroupState{AnyOn: false},
+	}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("GetGroups() = %s; want %s", hueV2TestJson(actual), hueV2TestJson(expected))
+	}
+}
+
+func TestHueV2Client_SetLightState(t *testing.T) {
+	server := newHueV2TestServer(t, nil)
+	client := server.client(t, server.hue())
+
+	if _, err := client.SetLightState(1, huego.State{On: true, Bri: 254, Hue: 46920, Sat: 254}); err != nil {
+		t.Fatalf("SetLightState() failed: %v", err)
+	}
+	if _, err := client.SetGroupState(2, huego.State{On: false, Bri: 254}); err != nil {
+		t.Fatalf("SetGroupState() failed: %v", err)
+	}
+
+	x, y := hueXyOf(46920, 254)
+	expected := []hueV2TestRequest{{
+		Path: "/clip/v2/resource/light/7a1c",
+		Body: fmt.Sprintf(`{"on":{"on":true},"dimming":{"brightness":100},"color":{"xy":{"x":%v,"y":%v}}}`, x, y),
+	}, {
+		// Nothing else than on is sent if it is switched off.
+		Path: "/clip/v2/resource/grouped_light/4d2e",
+		Body: `{"on":{"on":false}}`,
+	}}
+	if actual := server.puts(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("requests = %+v; want %+v", actual, expected)
+	}
+}
+
+func TestHue_v2Events(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	server := newHueV2TestServer(t, nil)
+	instance := server.hue()
+	instance.Bridge = server.host()
+	instance.User = "test"
+	instance.Api = HueApiV2
+	instance.Kinds = AllHueKinds
+	instance.Name = regexp.MustCompile("^Desk$")
+
+	if err := instance.Initialize(); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+	t.Cleanup(func() { _ = instance.Dispose() })
+	if actual := hueV2TestLightState(instance); !actual.On {
+		t.Fatalf("light is off initially: %+v", actual)
+	}
+
+	// Switched off and dimmed outside of this application.
+	server.events <- `[{"type":"update","data":[{"id":"7a1c","type":"light","on":{"on":false}},{"id":"7a1c","type":"light","dimming":{"brightness":10}}]}]`
+
+	deadline := time.Now().Add(5 * time.Second)
+	for actual := hueV2TestLightState(instance); actual.On || actual.Bri != 25; actual = hueV2TestLightState(instance) {
+		if time.Now().After(deadline) {
+			t.Fatalf("state of light not updated by event; got: %+v", actual)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if actual := hueV2TestLightState(instance); !reflect.DeepEqual(actual.Xy, []float32{0.3, 0.3}) {
+		t.Errorf("xy = %v; want it unchanged", actual.Xy)
+	}
+}
+
+func hueV2TestLightState(instance *Hue) huego.State {
+	instance.mutex.Lock()
+	defer instance.mutex.Unlock()
+	return *instance.lights[0].State
+}
+
+// hueV2TestResources are the resources served by hueV2TestServer: light 1
+// (Desk) is part of room 1 (Office) via its device and light 2 (Shelf) of
+// zone 2 (Shelves) directly.
+var hueV2TestResources = map[string]string{
+	"light": `[
+		{"id":"7a1c","id_v1":"/lights/1","type":"light","owner":{"rid":"d001","rtype":"device"},"metadata":{"name":"Desk","archetype":"desk_lamp"},"on":{"on":true},"dimming":{"brightness":50},"color":{"xy":{"x":0.3,"y":0.3}}},
+		{"id":"9b3f","id_v1":"/lights/2","type":"light","owner":{"rid":"d002","rtype":"device"},"metadata":{"name":"Shelf","archetype":"flood_bulb"},"on":{"on":false},"dimming":{"brightness":100},"color_temperature":{"mirek":366,"mirek_valid":true}},
+		{"id":"0000","type":"light","metadata":{"name":"Without v1"}}
+	]`,
+	"zigbee_connectivity": `[
+		{"id":"z001","type":"zigbee_connectivity","owner":{"rid":"d001","rtype":"device"},"status":"connected"},
+		{"id":"z002","type":"zigbee_connectivity","owner":{"rid":"d002","rtype":"device"},"status":"connectivity_issue"}
+	]`,
+	"grouped_light": `[
+		{"id":"1f0a","id_v1":"/groups/1","type":"grouped_light","on":{"on":true},"dimming":{"brightness":50}},
+		{"id":"4d2e","id_v1":"/groups/2","type":"grouped_light","on":{"on":false}}
+	]`,
+	"room": `[
+		{"id":"r001","id_v1":"/groups/1","type":"room","metadata":{"name":"Office"},"children":[{"rid":"d001","rtype":"device"}],"services":[{"rid":"1f0a","rtype":"grouped_light"}]}
+	]`,
+	"zone": `[
+		{"id":"z0n3","id_v1":"/groups/2","type":"zone","metadata":{"name":"Shelves"},"children":[{"rid":"9b3f","rtype":"light"}],"services":[{"rid":"4d2e","rtype":"grouped_light"}]}
+	]`,
+	"scene": `[
+		{"id":"5c01","id_v1":"/scenes/AbCdEf","type":"scene","metadata":{"name":"Focus"},"group":{"rid":"r001","rtype":"room"},"status":{"active":"static"}},
+		{"id":"5c02","type":"scene","metadata":{"name":"Relax"},"group":{"rid":"z0n3","rtype":"zone"},"status":{"active":"inactive"}}
+	]`,
+}
+
+type hueV2TestRequest struct {
+	Path string
+	Body string
+}
+
+// hueV2TestServer serves hueV2TestResources like a bridge via the CLIP API
+// v2, records every PUT and sends everything written to events via the
+// event stream. Pairing succeeds with the second attempt, as if the link
+// button was pressed in the meantime.
+type hueV2TestServer struct {
+	server   *httptest.Server
+	events   chan string
+	requests chan hueV2TestRequest
+	pairs    atomic.Int32
+}
+
+// newHueV2TestServer starts a server using the given certificate or the
+// default one of httptest if nil.
+func newHueV2TestServer(t *testing.T, certificate *tls.Certificate) *hueV2TestServer {
+	t.Helper()
+	result := &hueV2TestServer{
+		events:   make(chan string, 10),
+		requests: make(chan hueV2TestRequest, 10),
+	}
+	result.server = httptest.NewUnstartedServer(http.HandlerFunc(result.handle))
+	if certificate != nil {
+		result.server.TLS = &tls.Config{Certificates: []tls.Certificate{*certificate}}
+	}
+	result.server.StartTLS()
+	t.Cleanup(result.server.Close)
+	return result
+}
+
+func (this *hueV2TestServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api" && r.Method == http.MethodPost {
+		b, _ := io.ReadAll(r.Body)
+		this.requests <- hueV2TestRequest{r.URL.Path, string(b)}
+		if this.pairs.Add(1) == 1 {
+			_, _ = w.Write([]byte(`[{"error":{"type":101,"address":"","description":"link button not pressed"}}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"success":{"username":"test"}}]`))
+		return
+	}
+	if r.Header.Get("hue-application-key") != "test" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":[{"description":"unauthorized user"}],"data":[]}`))
+		return
+	}
+
+	if r.URL.Path == "/eventstream/clip/v2" {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case data := <-this.events:
+				_, _ = fmt.Fprintf(w, ": hi\n\nid: 1:0\ndata: %s\n\n", data)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/clip/v2/resource/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	resourceType, id, _ := strings.Cut(path, "/")
+	switch r.Method {
+	case http.MethodGet:
+		var resources []json.RawMessage
+		_ = json.Unmarshal([]byte(hueV2TestResources[resourceType]), &resources)
+		if id != "" {
+			var found []json.RawMessage
+			for _, v := range resources {
+				if strings.Contains(string(v), `"id":"`+id+`"`) {
+					found = append(found, v)
+				}
+			}
+			resources = found
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"errors": []any{}, "data": resources})
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		this.requests <- hueV2TestRequest{r.URL.Path, string(b)}
+		_, _ = fmt.Fprintf(w, `{"errors":[],"data":[{"rid":"%s","rtype":"%s"}]}`, id, resourceType)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (this *hueV2TestServer) host() string {
+	return this.server.Listener.Addr().String()
+}
+
+// hue returns a Hue which trusts the certificate of this server.
+func (this *hueV2TestServer) hue() *Hue {
+	sum := sha256.Sum256(this.server.Certificate().Raw)
+	return &Hue{Fingerprint: hex.EncodeToString(sum[:])}
+}
+
+func (this *hueV2TestServer) client(t *testing.T, hue *Hue) *hueV2Client {
+	t.Helper()
+	result, err := hue.newV2Client(HueCredentials{Host: this.host(), User: "test"})
+	if err != nil {
+		t.Fatalf("newV2Client() failed: %v", err)
+	}
+	return result
+}
+
+func (this *hueV2TestServer) puts() (result []hueV2TestRequest) {
+	for {
+		select {
+		case v := <-this.requests:
+			result = append(result, v)
+		default:
+			return
+		}
+	}
+}
+
+func hueV2TestJson(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+type hueV2TestCa struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newHueV2TestCa(t *testing.T) *hueV2TestCa {
+	t.Helper()
+	key := hueV2TestKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root-bridge"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create certificate authority: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("cannot parse certificate authority: %v", err)
+	}
+	return &hueV2TestCa{certificate, key}
+}
+
+// issue creates a certificate for the given common name, like the bridges
+// are using it: without any host name.
+func (this *hueV2TestCa) issue(t *testing.T, commonName string) *tls.Certificate {
+	t.Helper()
+	key := hueV2TestKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, this.certificate, &key.PublicKey, this.key)
+	if err != nil {
+		t.Fatalf("cannot issue certificate: %v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (this *hueV2TestCa) file(t *testing.T) string {
+	t.Helper()
+	result := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: this.certificate.Raw})
+	if err := os.WriteFile(result, b, 0644); err != nil {
+		t.Fatalf("cannot write certificate authority: %v", err)
+	}
+	return result
+}
+
+func hueV2TestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	result, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+	return result
+}
@@ -38,3 +38,17 @@ func (this *Hue) storeCredentials(v HueCredentials) error {
 
 	return nil
 }
+
+func (this *Hue) deleteCredentials() error {
+	c, err := wincred.GetGenericCredential(appName)
+	if err == windows.ERROR_NOT_FOUND {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot retrieve HUE crendtials from Windows Credentials store: %w", err)
+	}
+	if err := c.Delete(); err != nil {
+		return fmt.Errorf("cannot delete HUE crendtials from Windows Credentials store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package signal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	log "github.com/echocat/slf4g"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Mqtt struct {
+	Broker   string
+	ClientId string
+	Username string
+	Password string
+
+	TlsCa                 string
+	TlsInsecureSkipVerify bool
+
+	Topic    string
+	Qos      uint8
+	Payloads map[string]string
+	Timeout  time.Duration
+
+	client       mqtt.Client
+	wanted       *State
+	lastSent     *State
+	reconnecting atomic.Bool
+	mutex        sync.Mutex
+}
+
+func (this *Mqtt) SetupConfiguration(using common.FlagHolder) {
+	if this.Payloads == nil {
+		this.Payloads = map[string]string{}
+	}
+
+	using.Flag("signal.mqtt.broker", "URL of the MQTT broker. Examples: tcp://localhost:1883, ssl://localhost:8883").
+		Envar("TI_SIGNAL_MQTT_BROKER").
+		Default("tcp://localhost:1883").
+		StringVar(&this.Broker)
+	using.Flag("signal.mqtt.clientId", "Client ID to connect with. If empty one will be generated.").
+		Envar("TI_SIGNAL_MQTT_CLIENT_ID").
+		StringVar(&this.ClientId)
+	using.Flag("signal.mqtt.username", "Username to authenticate at the broker with.").
+		Envar("TI_SIGNAL_MQTT_USERNAME").
+		StringVar(&this.Username)
+	common.Secret(using.Flag("signal.mqtt.password", "Password to authenticate at the broker with.")).
+		Envar("TI_SIGNAL_MQTT_PASSWORD").
+		StringVar(&this.Password)
+	using.Flag("signal.mqtt.tls.ca", "PEM file with the certificate authorities to verify the broker with. If empty the ones of the system are used.").
+		Envar("TI_SIGNAL_MQTT_TLS_CA").
+		StringVar(&this.TlsCa)
+	using.Flag("signal.mqtt.tls.insecureSkipVerify", "If true the certificate of the broker will not be verified.").
+		Envar("TI_SIGNAL_MQTT_TLS_INSECURE_SKIP_VERIFY").
+		BoolVar(&this.TlsInsecureSkipVerify)
+	using.Flag("signal.mqtt.topic", "Topic where the state is published to (retained). It will also receive the state off as last will if this application terminates unexpectedly.").
+		Envar("TI_SIGNAL_MQTT_TOPIC").
+		Default("talk-indicator/state").
+		StringVar(&this.Topic)
+	using.Flag("signal.mqtt.qos", "Quality of service level to publish with (0, 1 or 2).").
+		Envar("TI_SIGNAL_MQTT_QOS").
+		Default("1").
+		Uint8Var(&this.Qos)
+	using.Flag("signal.mqtt.payload", "Payload which should be published for a specific state. Format: <state>=<payload>. States without explicit payload will publish their name.").
+		Envar("TI_SIGNAL_MQTT_PAYLOAD").
+		StringMapVar(&this.Payloads)
+	using.Flag("signal.mqtt.timeout", "How long to wait for the broker to connect or acknowledge a publish.").
+		Envar("TI_SIGNAL_MQTT_TIMEOUT").
+		Default("10s").
+		DurationVar(&this.Timeout)
+}
+
+func (this *Mqtt) Initialize() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.Qos > 2 {
+		return fmt.Errorf("illegal QoS for mqtt signal: %d", this.Qos)
+	}
+	offPayload, err := this.payloadFor(StateOff)
+	if err != nil {
+		return err
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(this.Broker).
+		SetClientID(this.ClientId).
+		SetUsername(this.Username).
+		SetPassword(this.Password).
+		SetProtocolVersion(4).
+		SetConnectTimeout(this.Timeout).
+		SetAutoReconnect(true).
+		SetBinaryWill(this.Topic, offPayload, this.Qos, true).
+		SetReconnectingHandler(func(mqtt.Client, *mqtt.ClientOptions) {
+			// This is called synchronously before each attempt, so it is
+			// always visible to the OnConnectHandler of the reconnect.
+			this.reconnecting.Store(true)
+		}).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			log.With("broker", this.Broker).
+				Debug("Connected to MQTT broker.")
+			if !this.reconnecting.Swap(false) {
+				// Initial connect; Ensure will publish.
+				return
+			}
+
+			this.mutex.Lock()
+			defer this.mutex.Unlock()
+			// The broker has published our last will in the meantime, so publish again.
+			this.lastSent = nil
+			if v := this.wanted; v != nil {
+				if err := this.publish(client, *v); err != nil {
+					log.WithError(err).
+						With("broker", this.Broker).
+						Warn("Cannot publish state again after reconnect to MQTT broker.")
+				}
+			}
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.WithError(err).
+				With("broker", this.Broker).
+				Warn("Connection to MQTT broker lost.")
+		})
+
+	if this.TlsCa != "" || this.TlsInsecureSkipVerify {
+		tlsConfig, err := this.tlsConfig()
+		if err != nil {
+			return err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	// The client must not stay around on failures; it would keep connecting
+	// in the background and publish next to the one of a later attempt.
+	if !token.WaitTimeout(this.Timeout) {
+		client.Disconnect(0)
+		return fmt.Errorf("cannot connect to MQTT broker %s: timeout after %v", this.Broker, this.Timeout)
+	}
+	if err := token.Error(); err != nil {
+		client.Disconnect(0)
+		return fmt.Errorf("cannot connect to MQTT broker %s: %w", this.Broker, err)
+	}
+
+	this.client = client
+	this.lastSent = nil
+	return nil
+}
+
+func (this *Mqtt) tlsConfig() (*tls.Config, error) {
+	result := &tls.Config{
+		InsecureSkipVerify: this.TlsInsecureSkipVerify,
+	}
+	if this.TlsCa != "" {
+		b, err := os.ReadFile(this.TlsCa)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read certificate authorities for mqtt signal from %s: %w", this.TlsCa, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found for mqtt signal in %s", this.TlsCa)
+		}
+		result.RootCAs = pool
+	}
+	return result, nil
+}
+
+func (this *Mqtt) payloadFor(state State) ([]byte, error) {
+	for plainState, payload := range this.Payloads {
+		var candidate State
+		if err := candidate.Set(plainState); err != nil {
+			return nil, fmt.Errorf("illegal state of payload for mqtt signal: %w", err)
+		}
+		if candidate == state {
+			return []byte(payload), nil
+		}
+	}
+	return []byte(state.String()), nil
+}
+
+func (this *Mqtt) Dispose() error {
+	this.mutex.Lock()
+	client := this.client
+	this.client = nil
+	this.mutex.Unlock()
+
+	if client != nil {
+		client.Disconnect(uint(this.Timeout.Milliseconds()))
+	}
+	return nil
+}
+
+func (this *Mqtt) Update() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	// Forget what was sent before, so the next Ensure will publish it again.
+	this.lastSent = nil
+	return nil
+}
+
+func (this *Mqtt) Ensure(state State) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.client == nil {
+		return fmt.Errorf("mqtt signal not initialized")
+	}
+	this.wanted = &state
+	if v := this.lastSent; v != nil && *v == state {
+		return nil
+	}
+
+	return this.publish(this.client, state)
+}
+
+// Release switches off unless successor publishes to the same topic of the
+// same broker.
+func (this *Mqtt) Release(successor Signal) error {
+	if v, ok := successor.(*Mqtt); ok && v.Broker == this.Broker && v.Topic == this.Topic {
+		return nil
+	}
+	return this.Ensure(StateOff)
+}
+
+func (this *Mqtt) publish(client mqtt.Client, state State) error {
+	payload, err := this.payloadFor(state)
+	if err != nil {
+		return err
+	}
+
+	token := client.Publish(this.Topic, this.Qos, true, payload)
+	if !token.WaitTimeout(this.Timeout) {
+		return fmt.Errorf("cannot publish state %v to topic %q of MQTT broker %s: timeout after %v", state, this.Topic, this.Broker, this.Timeout)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("cannot publish state %v to topic %q of MQTT broker %s: %w", state, this.Topic, this.Broker, err)
+	}
+
+	this.lastSent = &state
+	return nil
+}
+
+func (this *Mqtt) GetType() Type {
+	return TypeMqtt
+}
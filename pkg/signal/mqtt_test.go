@@ -0,0 +1,190 @@
+package signal
+
+import (
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMqtt_Ensure_publishesRetained(t *testing.T) {
+	broker := newMqttTestBroker(t)
+	instance := broker.mqtt(t)
+
+	if err := instance.Ensure(StateOn); err != nil {
+		t.Fatalf("Ensure() failed: %v", err)
+	}
+
+	// Subscribing afterwards only receives something if it was retained.
+	messages := broker.subscribe(t)
+	broker.expect(t, messages, mqttTestMessage{"on", true})
+}
+
+func TestMqtt_lastWillAndRepublishOnReconnect(t *testing.T) {
+	broker := newMqttTestBroker(t)
+	instance := broker.mqtt(t)
+
+	if err := instance.Ensure(StateSpeaking); err != nil {
+		t.Fatalf("Ensure() failed: %v", err)
+	}
+	messages := broker.subscribe(t)
+	broker.expect(t, messages, mqttTestMessage{"speaking", true})
+
+	// Drop the connection without a DISCONNECT packet, like a crash would.
+	client, ok := broker.server.Clients.Get(instance.ClientId)
+	if !ok {
+		t.Fatalf("client %s not connected to broker", instance.ClientId)
+	}
+	_ = client.Net.Conn.Close()
+
+	broker.expect(t, messages, mqttTestMessage{"off", true})
+	// The client reconnects on its own and publishes its state again.
+	broker.expect(t, messages, mqttTestMessage{"speaking", true})
+	broker.expect(t, broker.subscribe(t), mqttTestMessage{"speaking", true})
+}
+
+func TestMqtt_Dispose_doesNotSendLastWill(t *testing.T) {
+	broker := newMqttTestBroker(t)
+	instance := broker.mqtt(t)
+
+	if err := instance.Ensure(StateOn); err != nil {
+		t.Fatalf("Ensure() failed: %v", err)
+	}
+	messages := broker.subscribe(t)
+	broker.expect(t, messages, mqttTestMessage{"on", true})
+
+	if err := instance.Dispose(); err != nil {
+		t.Fatalf("Dispose() failed: %v", err)
+	}
+
+	select {
+	case m := <-messages:
+		t.Errorf("unexpected message after graceful disconnect: %+v", m)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestMqtt_Initialize_disconnectsOnTimeout(t *testing.T) {
+	// Accepts connections, but never acknowledges them.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	closed := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(io.Discard, conn)
+				closed <- struct{}{}
+			}()
+		}
+	}()
+
+	instance := &Mqtt{
+		Broker:   "tcp://" + listener.Addr().String(),
+		ClientId: "talk-indicator-" + t.Name(),
+		Topic:    mqttTestTopic,
+		Timeout:  100 * time.Millisecond,
+	}
+	if err := instance.Initialize(); err == nil {
+		t.Fatalf("Initialize() should fail")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection not closed after timeout")
+	}
+}
+
+const mqttTestTopic = "talk-indicator/test"
+
+type mqttTestBroker struct {
+	server  *mochi.Server
+	address string
+}
+
+type mqttTestMessage struct {
+	Payload  string
+	Retained bool
+}
+
+func newMqttTestBroker(t *testing.T) *mqttTestBroker {
+	t.Helper()
+
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatalf("cannot add auth hook: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	if err := server.AddListener(listeners.NewNet("test", listener)); err != nil {
+		t.Fatalf("cannot add listener: %v", err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatalf("cannot serve: %v", err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	return &mqttTestBroker{
+		server:  server,
+		address: "tcp://" + listener.Addr().String(),
+	}
+}
+
+func (this *mqttTestBroker) mqtt(t *testing.T) *Mqtt {
+	t.Helper()
+
+	result := &Mqtt{
+		Broker:   this.address,
+		ClientId: "talk-indicator-" + t.Name(),
+		Topic:    mqttTestTopic,
+		Qos:      1,
+		Timeout:  5 * time.Second,
+	}
+	if err := result.Initialize(); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+	t.Cleanup(func() { _ = result.Dispose() })
+	return result
+}
+
+func (this *mqttTestBroker) subscribe(t *testing.T) <-chan mqttTestMessage {
+	t.Helper()
+
+	result := make(chan mqttTestMessage, 10)
+	if err := this.server.Subscribe(mqttTestTopic, 1, func(_ *mochi.Client, _ packets.Subscription, pk packets.Packet) {
+		result <- mqttTestMessage{string(pk.Payload), pk.FixedHeader.Retain}
+	}); err != nil {
+		t.Fatalf("cannot subscribe: %v", err)
+	}
+	return result
+}
+
+func (this *mqttTestBroker) expect(t *testing.T, messages <-chan mqttTestMessage, expected mqttTestMessage) {
+	t.Helper()
+
+	select {
+	case actual := <-messages:
+		if actual != expected {
+			t.Fatalf("received %+v; want %+v", actual, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("did not receive %+v", expected)
+	}
+}
@@ -0,0 +1,116 @@
+package signal
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	log "github.com/echocat/slf4g"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record does not signal anything to the outside world, but records every
+// call as a JSON line into File. This makes it possible to check afterwards
+// what the application would have done; for example in tests.
+type Record struct {
+	File string
+
+	out   io.WriteCloser
+	mutex sync.Mutex
+}
+
+type RecordEntry struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	State *State    `json:"state,omitempty"`
+}
+
+func (this *Record) SetupConfiguration(using common.FlagHolder) {
+	using.Flag("signal.record.file", "File where every signal event should be recorded to as JSON lines. If empty the events will only be logged.").
+		Envar("TI_SIGNAL_RECORD_FILE").
+		StringVar(&this.File)
+}
+
+func (this *Record) Initialize() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.File != "" {
+		f, err := os.OpenFile(this.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("cannot open signal record file %s: %w", this.File, err)
+		}
+		this.out = f
+	}
+
+	return this.record("initialize", nil)
+}
+
+func (this *Record) Dispose() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	rErr := this.record("dispose", nil)
+	if out := this.out; out != nil {
+		this.out = nil
+		if err := out.Close(); err != nil && rErr == nil {
+			rErr = fmt.Errorf("cannot close signal record file %s: %w", this.File, err)
+		}
+	}
+	return rErr
+}
+
+func (this *Record) Ensure(state State) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.record("ensure", &state)
+}
+
+// Release records StateOff unless successor records into the same file.
+func (this *Record) Release(successor Signal) error {
+	if v, ok := successor.(*Record); ok && v.File == this.File {
+		return nil
+	}
+	return this.Ensure(StateOff)
+}
+
+func (this *Record) Update() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.record("update", nil)
+}
+
+func (this *Record) record(event string, state *State) error {
+	entry := RecordEntry{
+		Time:  time.Now(),
+		Event: event,
+		State: state,
+	}
+
+	l := log.With("event", event)
+	if state != nil {
+		l = l.With("state", *state)
+	}
+	l.Debug("Signal event recorded.")
+
+	if this.out == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("cannot marshal signal record entry: %w", err)
+	}
+	if _, err := this.out.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("cannot write to signal record file %s: %w", this.File, err)
+	}
+	return nil
+}
+
+func (this *Record) GetType() Type {
+	return TypeRecord
+}
@@ -11,3 +11,31 @@ type Signal interface {
 
 	GetType() Type
 }
+
+// TargetedSignal is a Signal which addresses several targets (like lights)
+// and is able to report the result for each of them.
+type TargetedSignal interface {
+	Signal
+
+	// EnsureTargets does the same as Ensure, but continues on failures and
+	// reports the result of each target.
+	EnsureTargets(State) []TargetResult
+}
+
+// TargetResult is the result of ensuring a State at a single target of a
+// Signal.
+type TargetResult struct {
+	Type   Type
+	Target string
+	Error  error
+}
+
+// ReplaceableSignal is a Signal which knows which of its targets are also
+// addressed by another instance of the same Type which replaces it.
+type ReplaceableSignal interface {
+	Signal
+
+	// Release switches every target off which is not addressed by successor,
+	// too. successor is nil if there is no instance of the same Type anymore.
+	Release(successor Signal) error
+}
@@ -8,14 +8,20 @@ import (
 type State uint8
 
 const (
-	StateOff = State(0)
-	StateOn  = State(1)
+	StateOff      = State(0)
+	StateOn       = State(1)
+	StateMuted    = State(2)
+	StateSpeaking = State(3)
+	StateCamera   = State(4)
 )
 
 var (
 	AllStates = States{
 		StateOff,
 		StateOn,
+		StateMuted,
+		StateSpeaking,
+		StateCamera,
 	}
 )
 
@@ -27,6 +33,15 @@ func (this *State) Set(plain string) error {
 	case "on", "1", "true", "yes":
 		*this = StateOn
 		return nil
+	case "muted", "mute":
+		*this = StateMuted
+		return nil
+	case "speaking", "speak", "talking":
+		*this = StateSpeaking
+		return nil
+	case "camera", "video":
+		*this = StateCamera
+		return nil
 	default:
 		return fmt.Errorf("illegal-signal-state: %s", plain)
 	}
@@ -38,11 +53,25 @@ func (this State) String() string {
 		return "off"
 	case StateOn:
 		return "on"
+	case StateMuted:
+		return "muted"
+	case StateSpeaking:
+		return "speaking"
+	case StateCamera:
+		return "camera"
 	default:
 		return fmt.Sprintf("illegal-signal-state-%d", this)
 	}
 }
 
+func (this State) MarshalText() ([]byte, error) {
+	return []byte(this.String()), nil
+}
+
+func (this *State) UnmarshalText(text []byte) error {
+	return this.Set(string(text))
+}
+
 type States []State
 
 func (this States) Strings() []string {
@@ -8,7 +8,10 @@ import (
 type Type uint8
 
 const (
-	TypeHue = Type(0)
+	TypeHue     = Type(0)
+	TypeRecord  = Type(1)
+	TypeWebhook = Type(2)
+	TypeMqtt    = Type(3)
 
 	TypeDefault = TypeHue
 )
@@ -16,6 +19,9 @@ const (
 var (
 	AllTypes = Types{
 		TypeHue,
+		TypeRecord,
+		TypeWebhook,
+		TypeMqtt,
 	}
 )
 
@@ -24,6 +30,15 @@ func (this *Type) Set(plain string) error {
 	case "hue":
 		*this = TypeHue
 		return nil
+	case "record":
+		*this = TypeRecord
+		return nil
+	case "webhook":
+		*this = TypeWebhook
+		return nil
+	case "mqtt":
+		*this = TypeMqtt
+		return nil
 	default:
 		return fmt.Errorf("illegal-signal-type: %s", plain)
 	}
@@ -33,15 +48,35 @@ func (this Type) String() string {
 	switch this {
 	case TypeHue:
 		return "hue"
+	case TypeRecord:
+		return "record"
+	case TypeWebhook:
+		return "webhook"
+	case TypeMqtt:
+		return "mqtt"
 	default:
 		return fmt.Sprintf("illegal-signal-type-%d", this)
 	}
 }
 
+func (this Type) MarshalText() ([]byte, error) {
+	return []byte(this.String()), nil
+}
+
+func (this *Type) UnmarshalText(text []byte) error {
+	return this.Set(string(text))
+}
+
 func (this Type) newInstance() Signal {
 	switch this {
 	case TypeHue:
 		return &Hue{}
+	case TypeRecord:
+		return &Record{}
+	case TypeWebhook:
+		return &Webhook{}
+	case TypeMqtt:
+		return &Mqtt{}
 	default:
 		panic(fmt.Errorf("illegal-signal-type-%d", this))
 	}
@@ -0,0 +1,320 @@
+package signal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	log "github.com/echocat/slf4g"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const webhookDefaultBody = `{"state":"{{.State}}"}`
+
+var errWebhookSuperseded = errors.New("superseded by a newer state")
+
+type Webhook struct {
+	Url     string
+	Method  string
+	Headers map[string]string
+	Bodies  map[string]string
+
+	Timeout time.Duration
+	Retries uint8
+	Backoff time.Duration
+
+	url        *template.Template
+	bodies     map[State]*template.Template
+	client     http.Client
+	lastSent   *State
+	generation uint64
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mutex      sync.Mutex
+	sendMutex  sync.Mutex
+}
+
+// webhookRequest is one state which should be sent by Webhook.Ensure.
+type webhookRequest struct {
+	state      State
+	url        string
+	body       []byte
+	generation uint64
+	ctx        context.Context
+}
+
+type WebhookData struct {
+	State State
+	Time  time.Time
+}
+
+func (this *Webhook) SetupConfiguration(using common.FlagHolder) {
+	if this.Headers == nil {
+		this.Headers = map[string]string{}
+	}
+	if this.Bodies == nil {
+		this.Bodies = map[string]string{}
+	}
+
+	common.Secret(using.Flag("signal.webhook.url", "URL which should be called on every state change. It can be a Go template which has access to .State and .Time.")).
+		Envar("TI_SIGNAL_WEBHOOK_URL").
+		StringVar(&this.Url)
+	using.Flag("signal.webhook.method", "HTTP method which should be used to call the URL.").
+		Envar("TI_SIGNAL_WEBHOOK_METHOD").
+		Default(http.MethodPost).
+		StringVar(&this.Method)
+	common.Secret(using.Flag("signal.webhook.header", "Header which should be sent with each request. Format: <name>=<value>")).
+		Envar("TI_SIGNAL_WEBHOOK_HEADER").
+		StringMapVar(&this.Headers)
+	using.Flag("signal.webhook.body", "Go template of the body which should be sent for a specific state. It has access to .State and .Time. Format: <state>=<template>. States without explicit body will use: "+webhookDefaultBody).
+		Envar("TI_SIGNAL_WEBHOOK_BODY").
+		StringMapVar(&this.Bodies)
+	using.Flag("signal.webhook.timeout", "Timeout of each request.").
+		Envar("TI_SIGNAL_WEBHOOK_TIMEOUT").
+		Default("10s").
+		DurationVar(&this.Timeout)
+	using.Flag("signal.webhook.retries", "How often a failed request should be retried.").
+		Envar("TI_SIGNAL_WEBHOOK_RETRIES").
+		Default("3").
+		Uint8Var(&this.Retries)
+	using.Flag("signal.webhook.backoff", "How long to wait before the first retry. Each further retry will wait twice as long as the previous one.").
+		Envar("TI_SIGNAL_WEBHOOK_BACKOFF").
+		Default("1s").
+		DurationVar(&this.Backoff)
+}
+
+func (this *Webhook) Initialize() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.Url == "" {
+		return fmt.Errorf("no URL for webhook signal configured")
+	}
+	url, err := template.New("url").Parse(this.Url)
+	if err != nil {
+		return fmt.Errorf("illegal URL template for webhook signal: %w", err)
+	}
+
+	bodies := make(map[State]*template.Template, len(AllStates))
+	for _, state := range AllStates {
+		bodies[state], err = template.New(state.String()).Parse(webhookDefaultBody)
+		if err != nil {
+			return fmt.Errorf("illegal default body template for webhook signal: %w", err)
+		}
+	}
+	for plainState, plainBody := range this.Bodies {
+		var state State
+		if err := state.Set(plainState); err != nil {
+			return fmt.Errorf("illegal state of body for webhook signal: %w", err)
+		}
+		bodies[state], err = template.New(state.String()).Parse(plainBody)
+		if err != nil {
+			return fmt.Errorf("illegal body template of state %v for webhook signal: %w", state, err)
+		}
+	}
+
+	if cancel := this.cancel; cancel != nil {
+		cancel()
+	}
+	this.url = url
+	this.bodies = bodies
+	this.client.Timeout = this.Timeout
+	this.lastSent = nil
+	this.ctx, this.cancel = context.WithCancel(context.Background())
+
+	return nil
+}
+
+func (this *Webhook) Dispose() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	// Pending requests and retries are aborted.
+	if cancel := this.cancel; cancel != nil {
+		cancel()
+	}
+	this.url = nil
+	this.ctx, this.cancel = nil, nil
+	return nil
+}
+
+func (this *Webhook) Update() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	// Forget what was sent before, so the next Ensure will send it again.
+	this.lastSent = nil
+	return nil
+}
+
+// Ensure sends the given state and reports the result of this first attempt.
+// If it failed but can be retried, the retries happen in the background with
+// an increasing backoff, so the caller is not blocked by an unreachable
+// webhook. They are dropped if another state is ensured in the meantime or
+// Dispose is called.
+func (this *Webhook) Ensure(state State) error {
+	r, err := this.request(state)
+	if err != nil || r == nil {
+		return err
+	}
+
+	retryable, err := this.send(r)
+	if errors.Is(err, errWebhookSuperseded) {
+		log.With("state", state).
+			Debug("State for webhook superseded by a newer one. Dropping it.")
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	if retryable && this.Retries > 0 {
+		log.WithError(err).
+			With("state", state).
+			With("backoff", this.Backoff).
+			Warn("Cannot send state to webhook. Will retry...")
+		go this.retry(r)
+	}
+	return fmt.Errorf("cannot send state %v to webhook: %w", state, err)
+}
+
+func (this *Webhook) retry(r *webhookRequest) {
+	backoff := this.Backoff
+	for attempt := uint8(1); ; attempt++ {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		retryable, err := this.send(r)
+		if errors.Is(err, errWebhookSuperseded) {
+			log.With("state", r.state).
+				Debug("State for webhook superseded by a newer one. Dropping it.")
+			return
+		}
+		if err == nil {
+			log.With("state", r.state).
+				With("attempt", attempt).
+				Info("State sent to webhook after retry.")
+			return
+		}
+		if r.ctx.Err() != nil {
+			return
+		}
+		if !retryable || attempt >= this.Retries {
+			log.WithError(err).
+				With("state", r.state).
+				With("attempt", attempt).
+				Error("Cannot send state to webhook. Giving up.")
+			return
+		}
+		log.WithError(err).
+			With("state", r.state).
+			With("attempt", attempt).
+			With("backoff", backoff).
+			Warn("Cannot send state to webhook. Will retry...")
+	}
+}
+
+// Release switches off unless successor calls the same URL.
+func (this *Webhook) Release(successor Signal) error {
+	if v, ok := successor.(*Webhook); ok && v.Url == this.Url && v.Method == this.Method {
+		return nil
+	}
+	return this.Ensure(StateOff)
+}
+
+// request renders the request for the given state. It returns nil if this
+// state was already sent.
+func (this *Webhook) request(state State) (*webhookRequest, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.url == nil {
+		return nil, fmt.Errorf("webhook signal not initialized")
+	}
+	if v := this.lastSent; v != nil && *v == state {
+		return nil, nil
+	}
+
+	data := WebhookData{
+		State: state,
+		Time:  time.Now(),
+	}
+
+	var url, body bytes.Buffer
+	if err := this.url.Execute(&url, data); err != nil {
+		return nil, fmt.Errorf("cannot render URL of webhook signal for state %v: %w", state, err)
+	}
+	if tmpl, ok := this.bodies[state]; ok {
+		if err := tmpl.Execute(&body, data); err != nil {
+			return nil, fmt.Errorf("cannot render body of webhook signal for state %v: %w", state, err)
+		}
+	}
+
+	this.generation++
+	return &webhookRequest{
+		state:      state,
+		url:        url.String(),
+		body:       body.Bytes(),
+		generation: this.generation,
+		ctx:        this.ctx,
+	}, nil
+}
+
+func (this *Webhook) send(r *webhookRequest) (retryable bool, _ error) {
+	// Only one request at a time, so the states arrive in the order they
+	// were ensured.
+	this.sendMutex.Lock()
+	defer this.sendMutex.Unlock()
+
+	if !this.isCurrent(r) {
+		return false, errWebhookSuperseded
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, strings.ToUpper(this.Method), r.url, bytes.NewReader(r.body))
+	if err != nil {
+		return false, fmt.Errorf("cannot create request for %s: %w", r.url, err)
+	}
+	for name, value := range this.Headers {
+		req.Header.Set(name, value)
+	}
+	if len(r.body) > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return r.ctx.Err() == nil, fmt.Errorf("cannot call %s: %w", r.url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		this.mutex.Lock()
+		if this.generation == r.generation {
+			this.lastSent = &r.state
+		}
+		this.mutex.Unlock()
+		return false, nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		fmt.Errorf("%s %s responded with unexpected status %d", req.Method, r.url, resp.StatusCode)
+}
+
+func (this *Webhook) isCurrent(r *webhookRequest) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.generation == r.generation && this.ctx == r.ctx
+}
+
+func (this *Webhook) GetType() Type {
+	return TypeWebhook
+}
@@ -0,0 +1,151 @@
+package signal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhook_Ensure(t *testing.T) {
+	server, received := newWebhookTestServer(t, http.StatusOK)
+	instance := newWebhookTestInstance(t, server.URL, time.Millisecond)
+
+	for _, state := range []State{StateOn, StateOn, StateOff} {
+		if err := instance.Ensure(state); err != nil {
+			t.Fatalf("Ensure(%v) failed: %v", state, err)
+		}
+	}
+
+	expected := []string{`{"state":"on"}`, `{"state":"off"}`}
+	if actual := received(); !slices.Equal(actual, expected) {
+		t.Errorf("received = %v; want %v", actual, expected)
+	}
+}
+
+func TestWebhook_Ensure_retriesInBackground(t *testing.T) {
+	var calls int
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	instance := newWebhookTestInstance(t, server.URL, 50*time.Millisecond)
+
+	// Only the first attempt is reported; the caller does not wait for the
+	// retries.
+	if err := instance.Ensure(StateOn); err == nil {
+		t.Fatalf("Ensure() should report the failure of the first attempt")
+	}
+	mutex.Lock()
+	if calls != 1 {
+		t.Errorf("calls after Ensure() = %d; want 1", calls)
+	}
+	mutex.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mutex.Lock()
+		actual := calls
+		mutex.Unlock()
+		if actual == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("calls = %d; want 3", actual)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhook_Dispose_abortsRetries(t *testing.T) {
+	server, received := newWebhookTestServer(t, http.StatusServiceUnavailable)
+	instance := newWebhookTestInstance(t, server.URL, 100*time.Millisecond)
+
+	if err := instance.Ensure(StateOn); err == nil {
+		t.Fatalf("Ensure() should fail")
+	}
+	if err := instance.Dispose(); err != nil {
+		t.Fatalf("Dispose() failed: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if actual := received(); len(actual) != 1 {
+		t.Errorf("received = %v; want only the first attempt", actual)
+	}
+}
+
+func TestWebhook_Ensure_dropsSupersededRetries(t *testing.T) {
+	var mutex sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, string(b))
+		if string(b) == `{"state":"on"}` {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	instance := newWebhookTestInstance(t, server.URL, 100*time.Millisecond)
+
+	if err := instance.Ensure(StateOn); err == nil {
+		t.Fatalf("Ensure(on) should fail")
+	}
+	if err := instance.Ensure(StateOff); err != nil {
+		t.Fatalf("Ensure(off) failed: %v", err)
+	}
+	// Give the retry of on the chance to happen.
+	time.Sleep(300 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	expected := []string{`{"state":"on"}`, `{"state":"off"}`}
+	if !slices.Equal(received, expected) {
+		t.Errorf("received = %v; want %v", received, expected)
+	}
+}
+
+func newWebhookTestServer(t *testing.T, status int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mutex sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		received = append(received, string(b))
+		mutex.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), received...)
+	}
+}
+
+func newWebhookTestInstance(t *testing.T, url string, backoff time.Duration) *Webhook {
+	t.Helper()
+	instance := &Webhook{
+		Url:     url,
+		Method:  http.MethodPost,
+		Timeout: 2 * time.Second,
+		Retries: 3,
+		Backoff: backoff,
+	}
+	if err := instance.Initialize(); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+	t.Cleanup(func() { _ = instance.Dispose() })
+	return instance
+}
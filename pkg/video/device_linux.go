@@ -0,0 +1,97 @@
+package video
+
+import (
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const supported = true
+
+var videoDevicePattern = regexp.MustCompile(`^/dev/video(\d+)$`)
+
+func findDevices() (audio.Devices, error) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("cannot list processes: %w", err)
+	}
+
+	byDevice := map[uint32]*audio.Device{}
+	for _, proc := range procs {
+		pid, err := strconv.ParseUint(proc.Name(), 10, 32)
+		if err != nil || !proc.IsDir() {
+			continue
+		}
+		for _, file := range openedVideoDevicesOf(uint32(pid)) {
+			m := videoDevicePattern.FindStringSubmatch(file)
+			index, _ := strconv.ParseUint(m[1], 10, 32)
+
+			device, ok := byDevice[uint32(index)]
+			if !ok {
+				device = &audio.Device{
+					Name:  videoDeviceName(uint32(index)),
+					Index: uint32(index),
+				}
+				byDevice[uint32(index)] = device
+			}
+			device.Sessions = append(device.Sessions, videoSessionOf(file, uint32(pid)))
+		}
+	}
+
+	result := make(audio.Devices, 0, len(byDevice))
+	for _, device := range byDevice {
+		result = append(result, *device)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Index < result[j].Index
+	})
+
+	return result, nil
+}
+
+// openedVideoDevicesOf returns all video devices which are opened by the
+// given process. Processes we are not allowed to inspect or which are already
+// gone are silently ignored.
+func openedVideoDevicesOf(pid uint32) (result []string) {
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	fds, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join(dir, fd.Name()))
+		if err != nil || seen[target] || !videoDevicePattern.MatchString(target) {
+			continue
+		}
+		seen[target] = true
+		result = append(result, target)
+	}
+	return
+}
+
+func videoDeviceName(index uint32) string {
+	if b, err := os.ReadFile(fmt.Sprintf("/sys/class/video4linux/video%d/name", index)); err == nil {
+		if v := strings.TrimSpace(string(b)); v != "" {
+			return v
+		}
+	}
+	return fmt.Sprintf("/dev/video%d", index)
+}
+
+func videoSessionOf(file string, pid uint32) audio.Session {
+	s := audio.Session{
+		Identifier: file,
+		HolderPid:  pid,
+	}
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		s.Identifier += "|" + exe
+	}
+	return s
+}
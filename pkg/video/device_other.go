@@ -0,0 +1,11 @@
+//go:build !linux
+
+package video
+
+import "github.com/blaubaer/talk-indicator/pkg/audio"
+
+const supported = false
+
+func findDevices() (audio.Devices, error) {
+	return nil, nil
+}
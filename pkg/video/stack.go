@@ -0,0 +1,111 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"github.com/blaubaer/talk-indicator/pkg/audio"
+	"github.com/blaubaer/talk-indicator/pkg/common"
+	"github.com/blaubaer/talk-indicator/pkg/metrics"
+	log "github.com/echocat/slf4g"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stack detects which processes are currently using a camera. Cameras are
+// reported as audio.Device and each process using it as audio.Session, so the
+// same filters can be applied to both.
+type Stack struct {
+	Enabled      bool
+	PollInterval time.Duration
+
+	initialized sync.Once
+}
+
+func (this *Stack) ensure() {
+	this.initialized.Do(func() {
+		this.Enabled = supported
+		this.PollInterval = 2 * time.Second
+	})
+}
+
+func (this *Stack) SetupConfiguration(using common.FlagHolder) {
+	this.ensure()
+
+	using.Flag("video.enabled", "If true it will be detected if a camera is in use, which will be signaled as state camera. This is currently only supported on Linux.").
+		Envar("TI_VIDEO_ENABLED").
+		Default(strconv.FormatBool(this.Enabled)).
+		BoolVar(&this.Enabled)
+	using.Flag("video.pollInterval", "How often it is checked if a camera is in use.").
+		Envar("TI_VIDEO_POLL_INTERVAL").
+		Default(this.PollInterval.String()).
+		DurationVar(&this.PollInterval)
+}
+
+func (this *Stack) Initialize() error {
+	this.ensure()
+
+	if this.Enabled && !supported {
+		return fmt.Errorf("detection of cameras in use is not supported on this platform")
+	}
+	return nil
+}
+
+func (this *Stack) Dispose() error {
+	return nil
+}
+
+func (this *Stack) FindDevices() (audio.Devices, error) {
+	this.ensure()
+
+	if !this.Enabled {
+		return nil, nil
+	}
+	defer metrics.Observe(metrics.FindDevicesDuration.WithLabelValues("video", runtime.GOOS), time.Now())
+	result, err := findDevices()
+	if err != nil {
+		return nil, err
+	}
+	result.ResolveProcesses()
+	return result, nil
+}
+
+// Watch emits the current devices immediately and afterwards every
+// PollInterval. If the detection is disabled nil is returned. Failures while
+// finding the devices are logged and skipped. The returned channel is closed
+// as soon as ctx is done.
+func (this *Stack) Watch(ctx context.Context) <-chan audio.Devices {
+	this.ensure()
+
+	if !this.Enabled {
+		return nil
+	}
+
+	result := make(chan audio.Devices)
+	go func() {
+		defer close(result)
+
+		for {
+			if devices, err := this.FindDevices(); err != nil {
+				log.WithError(err).
+					Error("Cannot find video devices.")
+			} else {
+				select {
+				case <-ctx.Done():
+					return
+				case result <- devices:
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				log.Debug("Video watch interrupted.")
+				return
+			case <-time.After(this.PollInterval):
+			}
+		}
+	}()
+
+	return result
+}